@@ -62,6 +62,23 @@ func BenchmarkEval(b *testing.B) {
 	}
 }
 
+func BenchmarkScriptRun(b *testing.B) {
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+
+	script, err := ctx.Compile(`"hello"`, "bench-script.js")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := script.Run(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkCallback(b *testing.B) {
 	ctx := NewIsolate().NewContext()
 	ctx.Global().Set("cb", ctx.Bind("cb", func(in CallbackArgs) (*Value, error) {
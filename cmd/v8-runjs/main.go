@@ -11,17 +11,31 @@
 //   console.warn:              write args to stderr in yellow
 //   console.error:             write args to stderr in scary red
 //
+// as well as setTimeout, setInterval, setImmediate and their clear* functions.
+// After each file (or REPL input) is run, any pending timers are run until
+// there are none left.  In the REPL, Ctrl-C stops waiting for the timers and
+// returns to the prompt; they continue after the next input.
+//
+// Like node, it can be debugged with Chrome DevTools:
+//   --inspect=127.0.0.1:9229      serve the Chrome DevTools Protocol
+//   --inspect-brk=127.0.0.1:9229  also wait for the debugger and break before
+//                                 the first statement
+//
 // Sooo... you can run your JS and print to the screen.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 
 	"github.com/augustoroman/v8"
+	"github.com/augustoroman/v8/eventloop"
+	"github.com/augustoroman/v8/inspector"
 	"github.com/augustoroman/v8/v8console"
 	"github.com/peterh/liner"
 )
@@ -31,16 +45,46 @@ const (
 	kRED   = "\033[91m"
 )
 
+var (
+	inspect    = flag.String("inspect", "", "Serve the Chrome DevTools Protocol at `host:port`")
+	inspectBrk = flag.String("inspect-brk", "", "Like --inspect, but wait for the debugger and break before the first statement")
+)
+
 func main() {
 	flag.Parse()
 	ctx := v8.NewIsolate().NewContext()
+
+	addr := *inspect
+	if *inspectBrk != "" {
+		addr = *inspectBrk
+	}
+	var server *inspector.Server
+	if addr != "" {
+		var err error
+		server, err = inspector.NewServer(ctx, addr)
+		failOnError(err)
+		defer server.Close()
+		fmt.Fprintf(os.Stderr, "Debugger listening on %s\n", server.WebSocketURL())
+		fmt.Fprintf(os.Stderr, "Open %s in Chrome\n", server.DevToolsURL())
+	}
+
 	v8console.Config{"", os.Stdout, os.Stderr, true}.Inject(ctx)
+	loop := eventloop.New(ctx, nil)
+
+	if server != nil {
+		failOnError(server.ForwardConsole())
+	}
+	if *inspectBrk != "" {
+		failOnError(server.WaitForDebugger(context.Background()))
+		failOnError(server.PauseOnNextStatement())
+	}
 
 	for _, filename := range flag.Args() {
 		data, err := ioutil.ReadFile(filename)
 		failOnError(err)
 		_, err = ctx.Eval(string(data), filename)
 		failOnError(err)
+		failOnError(loop.Run(context.Background()))
 	}
 
 	if flag.NArg() == 0 {
@@ -57,13 +101,40 @@ func main() {
 			result, err := ctx.Eval(jscode, "<input>")
 			if err != nil {
 				fmt.Println(kRED, err, kRESET)
-			} else {
-				fmt.Println(result)
+				continue
+			}
+			fmt.Println(result)
+			if err := runUntilInterrupted(loop); err != nil {
+				fmt.Println(kRED, err, kRESET)
 			}
 		}
 	}
 }
 
+// runUntilInterrupted runs the loop until there are no more timers or until
+// Ctrl-C is pressed, so that e.g. a setInterval doesn't take over the REPL.
+func runUntilInterrupted(loop *eventloop.Loop) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := loop.Run(ctx)
+	if err == context.Canceled {
+		fmt.Fprintln(os.Stderr, "(interrupted; pending timers continue after the next input)")
+		return nil
+	}
+	return err
+}
+
 func failOnError(err error) {
 	if err != nil {
 		panic(err)
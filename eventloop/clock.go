@@ -0,0 +1,85 @@
+package eventloop
+
+import (
+	"sync"
+	"time"
+)
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+func (systemClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// FakeClock is a Clock whose time only changes when Advance is called.  It is
+// safe for concurrent use.
+//
+// In tests, call Advance followed by Loop.RunPending to deterministically run
+// the timers that have expired.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+type fakeTimer struct {
+	when time.Time
+	c    chan time.Time
+}
+
+// NewFakeClock returns a FakeClock whose current time is start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer that fires once the fake time has been advanced by
+// at least d.
+func (c *FakeClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c.now.Add(d), make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c, func() bool { return false }
+	}
+	c.waiters = append(c.waiters, t)
+	return t.c, func() bool { return c.stop(t) }
+}
+
+func (c *FakeClock) stop(t *fakeTimer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance moves the fake time forward by d and fires any timers that have
+// expired.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, t := range c.waiters {
+		if t.when.After(c.now) {
+			waiting = append(waiting, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.waiters = waiting
+}
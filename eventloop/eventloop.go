@@ -0,0 +1,382 @@
+// Package eventloop provides a simple event loop that allows JS to use timers.
+//
+// It injects the setTimeout, setInterval, setImmediate, clearTimeout,
+// clearInterval, and clearImmediate functions into a Context.  The timers are
+// kept in Go and the callbacks are only run while the Loop is running, which
+// happens on the goroutine that calls Run or RunPending.  Microtasks (such as
+// promise callbacks) are run by V8 after each callback.  Like in browsers,
+// delays shorter than 1ms are 1ms, so an interval can't keep the loop busy.
+//
+// Go code can also hand promises to JS that are settled by asynchronous Go
+// functions, see Loop.Promise.
+package eventloop
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/augustoroman/v8"
+)
+
+// minDelay is the shortest delay of timers, like in browsers and node, so that
+// an interval always waits for the clock to advance before it runs again.
+const minDelay = time.Millisecond
+
+// Clock provides the current time and timers to the Loop.  Use FakeClock to
+// control time in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a channel that will receive the time once d has elapsed
+	// and a func to stop the timer.
+	NewTimer(d time.Duration) (c <-chan time.Time, stop func() bool)
+}
+
+// Loop is an event loop for a single Context.  The timer functions may be
+// called by javascript that runs on any goroutine, e.g. while the loop is
+// waiting in Run, but the callbacks only run on the goroutine that runs the
+// loop.
+type Loop struct {
+	ctx   *v8.Context
+	clock Clock
+
+	// mu guards the timers and the Go promises, since javascript that runs on
+	// other goroutines may schedule and clear timers.
+	mu         sync.Mutex
+	timers     timerHeap
+	immediates []*timer
+	byId       map[int]*timer
+	nextId     int
+	nextSeq    uint64
+
+	completed []func() error // Results of Go promises waiting to be settled.
+	inflight  int            // Number of Go promises that are not settled yet.
+	wake      chan struct{}
+}
+
+type timer struct {
+	id       int
+	when     time.Time
+	seq      uint64 // Preserves insertion order for timers with the same time.
+	interval time.Duration
+	repeat   bool
+	fn       *v8.Value
+	args     []*v8.Value
+	index    int // Index in the heap, or -1 if not scheduled.
+}
+
+// New creates a new Loop and injects the timer functions into the global
+// object of the specified Context.  If clock is nil, the system clock is used.
+func New(ctx *v8.Context, clock Clock) *Loop {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	l := &Loop{
+		ctx:   ctx,
+		clock: clock,
+		byId:  map[int]*timer{},
+		wake:  make(chan struct{}, 1),
+	}
+
+	functions := []struct {
+		name     string
+		callback v8.Callback
+	}{
+		{"setTimeout", l.setTimeout},
+		{"setInterval", l.setInterval},
+		{"setImmediate", l.setImmediate},
+		{"clearTimeout", l.clear},
+		{"clearInterval", l.clear},
+		{"clearImmediate", l.clear},
+	}
+	for _, fn := range functions {
+		if err := ctx.Global().Set(fn.name, ctx.Bind(fn.name, fn.callback)); err != nil {
+			// This should never happen: Global() is always an object.
+			panic(fmt.Errorf("cannot set %s into global: %v", fn.name, err))
+		}
+	}
+	return l
+}
+
+// Run runs the loop until there are no more timers or Go promises pending, or
+// until ctx is done.  If a callback throws an exception, Run stops and returns
+// the error; Run may be called again to continue with the remaining timers.
+func (l *Loop) Run(ctx context.Context) error {
+	for {
+		pending, err := l.RunPending()
+		if err != nil || !pending {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		immediate := len(l.immediates) > 0
+		l.mu.Unlock()
+		if immediate {
+			continue
+		}
+		if err := l.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// wait blocks until the next timer expires, a Go promise completes, a timer is
+// scheduled, or ctx is done.
+func (l *Loop) wait(ctx context.Context) error {
+	var timerC <-chan time.Time
+	l.mu.Lock()
+	if len(l.timers) > 0 {
+		c, stop := l.clock.NewTimer(l.timers[0].when.Sub(l.clock.Now()))
+		defer stop()
+		timerC = c
+	}
+	l.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timerC:
+	case <-l.wake:
+	}
+	return nil
+}
+
+// RunPending runs everything that is ready right now without waiting: settling
+// completed Go promises, immediates, and any timers that have expired.  It
+// returns whether there is still work pending.
+func (l *Loop) RunPending() (pending bool, err error) {
+	l.mu.Lock()
+	completed := l.completed
+	l.completed = nil
+	l.mu.Unlock()
+	for _, settle := range completed {
+		if err := settle(); err != nil {
+			return true, err
+		}
+	}
+
+	// Only run the immediates that were scheduled before now; new immediates
+	// will run on the next iteration.
+	l.mu.Lock()
+	immediates := l.immediates
+	l.immediates = nil
+	l.mu.Unlock()
+	for i, t := range immediates {
+		l.mu.Lock()
+		cleared := l.byId[t.id] != t
+		delete(l.byId, t.id)
+		l.mu.Unlock()
+		if cleared {
+			continue
+		}
+		if err := l.call(t); err != nil {
+			l.mu.Lock()
+			l.immediates = append(immediates[i+1:], l.immediates...)
+			l.mu.Unlock()
+			return true, err
+		}
+	}
+
+	// Only run the timers that were due when this pass started, so that a
+	// pass always ends; intervals and timers scheduled by the callbacks are
+	// due later anyway.
+	now := l.clock.Now()
+	l.mu.Lock()
+	last := l.nextSeq
+	for len(l.timers) > 0 && !l.timers[0].when.After(now) && l.timers[0].seq <= last {
+		t := heap.Pop(&l.timers).(*timer)
+		if t.repeat {
+			t.when = now.Add(t.interval)
+			t.seq = l.seq()
+			heap.Push(&l.timers, t)
+		} else {
+			delete(l.byId, t.id)
+		}
+		// The callback may schedule and clear timers.
+		l.mu.Unlock()
+		if err := l.call(t); err != nil {
+			return true, err
+		}
+		l.mu.Lock()
+	}
+	pending = l.inflight > 0 || len(l.completed) > 0 || len(l.timers) > 0 || len(l.immediates) > 0
+	l.mu.Unlock()
+	return pending, nil
+}
+
+// Promise returns a JS promise that is settled with the result of fn.  fn is
+// run in a new goroutine and must not use the Context.  Once fn returns, the
+// promise is settled by the loop: a non-nil error rejects the promise with a
+// JS Error, otherwise the promise is resolved with the result converted via
+// Context.Create.  The loop keeps running until all such promises are settled.
+func (l *Loop) Promise(fn func() (interface{}, error)) (*v8.Value, error) {
+	resolver, err := l.ctx.NewPromise()
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.inflight++
+	l.mu.Unlock()
+
+	go func() {
+		res, err := fn()
+		l.mu.Lock()
+		l.inflight--
+		l.completed = append(l.completed, func() error {
+			if err != nil {
+				return resolver.Reject(l.newError(err))
+			}
+			val, err := l.ctx.Create(res)
+			if err != nil {
+				return resolver.Reject(l.newError(err))
+			}
+			return resolver.Resolve(val)
+		})
+		l.mu.Unlock()
+		l.wakeUp()
+	}()
+
+	return resolver.Promise(), nil
+}
+
+// wakeUp wakes up Run if it's waiting.
+func (l *Loop) wakeUp() {
+	select {
+	case l.wake <- struct{}{}:
+	default: // the loop has already been woken up
+	}
+}
+
+func (l *Loop) newError(err error) *v8.Value {
+	msg, _ := l.ctx.Create(err.Error())
+	if ctor, _ := l.ctx.Global().Get("Error"); ctor != nil {
+		if errVal, _ := ctor.New(msg); errVal != nil {
+			return errVal
+		}
+	}
+	return msg
+}
+
+func (l *Loop) call(t *timer) error {
+	_, err := t.fn.Call(nil, t.args...)
+	return err
+}
+
+// seq returns the next sequence number. l.mu must be held.
+func (l *Loop) seq() uint64 {
+	l.nextSeq++
+	return l.nextSeq
+}
+
+func (l *Loop) schedule(in v8.CallbackArgs, repeat, immediate bool) (*v8.Value, error) {
+	fn := in.Arg(0)
+	if !fn.IsKind(v8.KindFunction) {
+		return nil, errors.New("callback must be a function")
+	}
+
+	var delay time.Duration
+	var args []*v8.Value
+	if immediate {
+		if len(in.Args) > 1 {
+			args = in.Args[1:]
+		}
+	} else {
+		// NaN, negative and tiny delays are minDelay; huge delays are capped
+		// at 2^31-1ms like in browsers, which also keeps them from
+		// overflowing.
+		delay = minDelay
+		if ms := in.Arg(1).Float64(); ms > 1 {
+			delay = time.Duration(math.Min(ms, math.MaxInt32) * float64(time.Millisecond))
+		}
+		if len(in.Args) > 2 {
+			args = in.Args[2:]
+		}
+	}
+
+	l.mu.Lock()
+	l.nextId++
+	t := &timer{
+		id:       l.nextId,
+		when:     l.clock.Now().Add(delay),
+		seq:      l.seq(),
+		interval: delay,
+		repeat:   repeat,
+		fn:       fn,
+		args:     args,
+		index:    -1,
+	}
+	l.byId[t.id] = t
+	if immediate {
+		l.immediates = append(l.immediates, t)
+	} else {
+		heap.Push(&l.timers, t)
+	}
+	l.mu.Unlock()
+	l.wakeUp() // Run may be waiting for a later timer.
+	return in.Context.Create(t.id)
+}
+
+func (l *Loop) setTimeout(in v8.CallbackArgs) (*v8.Value, error) {
+	return l.schedule(in, false, false)
+}
+
+func (l *Loop) setInterval(in v8.CallbackArgs) (*v8.Value, error) {
+	return l.schedule(in, true, false)
+}
+
+func (l *Loop) setImmediate(in v8.CallbackArgs) (*v8.Value, error) {
+	return l.schedule(in, false, true)
+}
+
+func (l *Loop) clear(in v8.CallbackArgs) (*v8.Value, error) {
+	id := int(in.Arg(0).Int64())
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t := l.byId[id]
+	if t == nil {
+		return nil, nil
+	}
+	delete(l.byId, id)
+	t.repeat = false
+	if t.index >= 0 {
+		heap.Remove(&l.timers, t.index)
+	}
+	return nil, nil
+}
+
+// timerHeap implements heap.Interface, ordering timers by expiration.
+type timerHeap []*timer
+
+func (h timerHeap) Len() int { return len(h) }
+func (h timerHeap) Less(a, b int) bool {
+	if h[a].when.Equal(h[b].when) {
+		return h[a].seq < h[b].seq
+	}
+	return h[a].when.Before(h[b].when)
+}
+func (h timerHeap) Swap(a, b int) {
+	h[a], h[b] = h[b], h[a]
+	h[a].index = a
+	h[b].index = b
+}
+func (h *timerHeap) Push(x interface{}) {
+	t := x.(*timer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+func (h *timerHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
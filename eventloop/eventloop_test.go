@@ -0,0 +1,190 @@
+package eventloop_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/augustoroman/v8"
+	"github.com/augustoroman/v8/eventloop"
+)
+
+// newLoop returns a Loop with a FakeClock and a global log() function that
+// records its argument in the global `logged` array.
+func newLoop(t *testing.T) (*v8.Context, *eventloop.Loop, *eventloop.FakeClock) {
+	ctx := v8.NewIsolate().NewContext()
+	clock := eventloop.NewFakeClock(time.Unix(0, 0))
+	loop := eventloop.New(ctx, clock)
+	if _, err := ctx.Eval(`var logged = []; function log(x) { logged.push(x); }`, "log.js"); err != nil {
+		t.Fatal(err)
+	}
+	return ctx, loop, clock
+}
+
+func eval(t *testing.T, ctx *v8.Context, js string) {
+	t.Helper()
+	if _, err := ctx.Eval(js, "test.js"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectLogged(t *testing.T, ctx *v8.Context, expected string) {
+	t.Helper()
+	res, err := ctx.Eval(`logged.join(',')`, "logged.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.String(); got != expected {
+		t.Errorf("Expected %q to be logged, got %q", expected, got)
+	}
+}
+
+func runPending(t *testing.T, loop *eventloop.Loop) bool {
+	t.Helper()
+	pending, err := loop.RunPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pending
+}
+
+func TestTimerOrder(t *testing.T) {
+	t.Parallel()
+	ctx, loop, clock := newLoop(t)
+	eval(t, ctx, `
+		setTimeout(() => log('b'), 20);
+		setTimeout(() => log('a1'), 10);
+		setTimeout(() => log('a2'), 10);
+		setImmediate(() => log('immediate'));
+		setTimeout(() => log('zero'), 0);
+		setTimeout(() => log('negative'), -5);
+	`)
+
+	runPending(t, loop)
+	expectLogged(t, ctx, "immediate")
+	clock.Advance(time.Millisecond)
+	runPending(t, loop)
+	expectLogged(t, ctx, "immediate,zero,negative")
+	clock.Advance(9 * time.Millisecond)
+	runPending(t, loop)
+	expectLogged(t, ctx, "immediate,zero,negative,a1,a2")
+	clock.Advance(10 * time.Millisecond)
+	if runPending(t, loop) {
+		t.Error("Expected no more pending timers")
+	}
+	expectLogged(t, ctx, "immediate,zero,negative,a1,a2,b")
+}
+
+func TestClear(t *testing.T) {
+	t.Parallel()
+	ctx, loop, clock := newLoop(t)
+	eval(t, ctx, `
+		clearTimeout(setTimeout(() => log('timeout'), 1));
+		clearInterval(setInterval(() => log('interval'), 1));
+		clearImmediate(setImmediate(() => log('immediate')));
+		clearTimeout(12345); // unknown ids are ignored
+		// Clearing a timer that is due in the same pass keeps it from running.
+		let later;
+		setTimeout(() => { log('first'); clearTimeout(later); }, 5);
+		later = setTimeout(() => log('later'), 5);
+	`)
+	clock.Advance(time.Second)
+	if runPending(t, loop) {
+		t.Error("Expected no more pending timers")
+	}
+	expectLogged(t, ctx, "first")
+}
+
+func TestInterval(t *testing.T) {
+	t.Parallel()
+	ctx, loop, clock := newLoop(t)
+	eval(t, ctx, `
+		let n = 0;
+		const id = setInterval(() => { log(++n); if (n == 3) clearInterval(id); }, 100);
+	`)
+	for i := 0; i < 5; i++ {
+		clock.Advance(100 * time.Millisecond)
+		runPending(t, loop)
+	}
+	expectLogged(t, ctx, "1,2,3")
+}
+
+func TestZeroInterval(t *testing.T) {
+	t.Parallel()
+	ctx, loop, clock := newLoop(t)
+	eval(t, ctx, `setInterval(() => log('tick'), 0);`)
+
+	// Each pass runs the interval at most once, however long it has been.
+	if !runPending(t, loop) {
+		t.Error("Expected the interval to be pending")
+	}
+	expectLogged(t, ctx, "")
+	clock.Advance(time.Second)
+	runPending(t, loop)
+	expectLogged(t, ctx, "tick")
+	runPending(t, loop)
+	expectLogged(t, ctx, "tick")
+	clock.Advance(time.Millisecond)
+	runPending(t, loop)
+	expectLogged(t, ctx, "tick,tick")
+}
+
+func TestRunCancel(t *testing.T) {
+	t.Parallel()
+	ctx := v8.NewIsolate().NewContext()
+	loop := eventloop.New(ctx, nil)
+	eval(t, ctx, `var ticks = 0; setInterval(() => ticks++, 0); setTimeout(() => {}, 3600e3);`)
+
+	goctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := loop.Run(goctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to stop Run, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %v to notice the deadline", elapsed)
+	}
+	if ticks, _ := ctx.Eval(`ticks`, "ticks.js"); ticks.Int64() == 0 {
+		t.Error("Expected the interval to run")
+	}
+}
+
+func TestRunError(t *testing.T) {
+	t.Parallel()
+	ctx, loop, clock := newLoop(t)
+	eval(t, ctx, `
+		setTimeout(() => { throw new Error('boom'); }, 1);
+		setTimeout(() => log('after'), 2);
+	`)
+	clock.Advance(time.Second)
+	if _, err := loop.RunPending(); err == nil {
+		t.Fatal("Expected the exception")
+	}
+	// The remaining timers still run.
+	if runPending(t, loop) {
+		t.Error("Expected no more pending timers")
+	}
+	expectLogged(t, ctx, "after")
+}
+
+func TestScheduleFromOtherGoroutine(t *testing.T) {
+	t.Parallel()
+	ctx := v8.NewIsolate().NewContext()
+	loop := eventloop.New(ctx, nil)
+	eval(t, ctx, `var done = false; var long = setTimeout(() => {}, 3600e3);`)
+
+	// Run wakes up for timers that javascript on other goroutines schedules
+	// while it waits.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ctx.Eval(`setTimeout(() => { done = true; clearTimeout(long); }, 1);`, "other.js")
+	}()
+	goctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := loop.Run(goctx); err != nil {
+		t.Fatal(err)
+	}
+	if done, _ := ctx.Eval(`done`, "done.js"); !done.Bool() {
+		t.Error("Expected the timer to run")
+	}
+}
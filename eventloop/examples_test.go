@@ -0,0 +1,114 @@
+package eventloop_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/augustoroman/v8"
+	"github.com/augustoroman/v8/eventloop"
+	"github.com/augustoroman/v8/v8console"
+)
+
+func ExampleLoop() {
+	ctx := v8.NewIsolate().NewContext()
+	v8console.Config{Stdout: os.Stdout, Stderr: os.Stdout}.Inject(ctx)
+	loop := eventloop.New(ctx, nil)
+
+	ctx.Eval(`
+        setTimeout(() => console.log('timeout 2'), 2);
+        setTimeout(msg => console.log(msg), 1, 'timeout 1');
+        setImmediate(() => console.log('immediate'));
+        Promise.resolve().then(() => console.log('microtask'));
+        const id = setTimeout(() => console.log('never'), 0);
+        clearTimeout(id);
+        console.log('sync');
+    `, "timers.js")
+	if err := loop.Run(context.Background()); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// sync
+	// microtask
+	// immediate
+	// timeout 1
+	// timeout 2
+}
+
+func ExampleFakeClock() {
+	ctx := v8.NewIsolate().NewContext()
+	v8console.Config{Stdout: os.Stdout, Stderr: os.Stdout}.Inject(ctx)
+	clock := eventloop.NewFakeClock(time.Unix(0, 0))
+	loop := eventloop.New(ctx, clock)
+
+	ctx.Eval(`
+        let ticks = 0;
+        const id = setInterval(() => {
+            console.log('tick', ++ticks);
+            if (ticks == 3) clearInterval(id);
+        }, 1000);
+    `, "interval.js")
+
+	for i := 0; i < 4; i++ {
+		clock.Advance(500 * time.Millisecond)
+		pending, err := loop.RunPending()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("pending:", pending)
+	}
+	clock.Advance(time.Hour)
+	pending, _ := loop.RunPending()
+	fmt.Println("pending:", pending)
+
+	// Output:
+	// pending: true
+	// tick 1
+	// pending: true
+	// pending: true
+	// tick 2
+	// pending: true
+	// tick 3
+	// pending: false
+}
+
+func ExampleLoop_Promise() {
+	ctx := v8.NewIsolate().NewContext()
+	v8console.Config{Stdout: os.Stdout, Stderr: os.Stdout}.Inject(ctx)
+	loop := eventloop.New(ctx, nil)
+
+	fetch, _ := ctx.BindFunc("fetch", func(url string) (*v8.Value, error) {
+		return loop.Promise(func() (interface{}, error) {
+			// Pretend to do some slow I/O.
+			time.Sleep(time.Millisecond)
+			if !strings.HasPrefix(url, "https://") {
+				return nil, errors.New("insecure url: " + url)
+			}
+			return map[string]string{"url": url, "body": "hello"}, nil
+		})
+	})
+	ctx.Global().Set("fetch", fetch)
+
+	ctx.Eval(`
+        (async () => {
+            const res = await fetch('https://example.com');
+            console.log(res.body, 'from', res.url);
+            try {
+                await fetch('http://example.com');
+            } catch (err) {
+                console.log('failed:', err.message);
+            }
+        })();
+    `, "fetch.js")
+	if err := loop.Run(context.Background()); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// hello from https://example.com
+	// failed: insecure url: http://example.com
+}
@@ -3,6 +3,7 @@ package v8_test
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/augustoroman/v8"
 )
@@ -52,3 +53,40 @@ func ExampleContext_Bind() {
 	// output:
 	// add(1,2,3,4,5) = 15
 }
+
+func ExampleContext_BindFunc() {
+	ctx := v8.NewIsolate().NewContext()
+
+	// Any Go function can be bound: the JS arguments are converted into the
+	// parameter types and the result is converted back into JS.
+	repeat := func(s string, n int) (string, error) {
+		if n < 0 {
+			return "", fmt.Errorf("cannot repeat %d times", n)
+		}
+		return strings.Repeat(s, n), nil
+	}
+	val, err := ctx.BindFunc("repeat", repeat)
+	if err != nil {
+		panic(err)
+	}
+	if err := ctx.Global().Set("repeat", val); err != nil {
+		panic(err)
+	}
+
+	result, err := ctx.Eval(`repeat("ab", 3)`, `example.js`)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(`repeat("ab", 3) =`, result)
+
+	// A non-nil error is thrown as a JS exception.
+	result, err = ctx.Eval(`try { repeat("ab", -1) } catch (e) { e.message }`, `example.js`)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(`repeat("ab", -1) threw:`, result)
+
+	// output:
+	// repeat("ab", 3) = ababab
+	// repeat("ab", -1) threw: cannot repeat -1 times
+}
@@ -0,0 +1,323 @@
+// Package inspector serves the Chrome DevTools Protocol for a v8.Context so
+// that its javascript can be debugged with Chrome DevTools, or any other
+// debugger that supports the protocol, just like node's --inspect:
+//
+//     server, err := inspector.NewServer(ctx, "127.0.0.1:9229")
+//     if err != nil { ... }
+//     defer server.Close()
+//     fmt.Println("Open", server.DevToolsURL())
+//     server.WaitForDebugger(context.Background())
+//     server.PauseOnNextStatement()
+//     ctx.Eval(code, "main.js") // pauses before the first statement
+//
+// Chrome also finds the server through chrome://inspect if its address is
+// configured there. The server accepts one debugger at a time. Like node's
+// inspector, it only accepts requests for localhost or an IP address, and
+// WebSockets from DevTools or non-browser clients, so that web pages can't
+// reach it, e.g. through DNS rebinding.
+package inspector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/augustoroman/v8"
+)
+
+// Server serves the Chrome DevTools Protocol for a Context over HTTP and
+// WebSockets.
+type Server struct {
+	ctx     *v8.Context
+	ln      net.Listener
+	http    *http.Server
+	id      string
+	console *v8.Value // V8's built-in console methods
+
+	mu      sync.Mutex
+	conn    *wsConn
+	in      *v8.Inspector
+	started chan struct{} // closed once a debugger asks to run
+}
+
+// NewServer starts serving the Chrome DevTools Protocol for the Context at the
+// TCP address addr, e.g. "127.0.0.1:9229". Don't listen on public addresses:
+// the debugger has full control over the javascript.
+//
+// NewServer must be called before replacing the Context's console, e.g. with
+// v8console.Config.Inject, so that ForwardConsole can find V8's console.
+func NewServer(ctx *v8.Context, addr string) (*Server, error) {
+	console, err := ctx.Eval(`(function(console) {
+		var builtin = {};
+		['debug', 'log', 'info', 'warn', 'error'].forEach(function(name) {
+			if (console && typeof console[name] === 'function') {
+				builtin[name] = console[name];
+			}
+		});
+		return builtin;
+	})(this.console)`, "<inspector>")
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ctx:     ctx,
+		ln:      ln,
+		id:      newId(),
+		console: console,
+		started: make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json", s.serveList)
+	mux.HandleFunc("/json/list", s.serveList)
+	mux.HandleFunc("/json/version", s.serveVersion)
+	mux.HandleFunc("/"+s.id, s.serveWebSocket)
+	s.http = &http.Server{Handler: checkHost(mux)}
+	go s.http.Serve(ln)
+	return s, nil
+}
+
+// Addr returns the address that the server listens on.
+func (s *Server) Addr() net.Addr { return s.ln.Addr() }
+
+// WebSocketURL returns the URL of the server's WebSocket, which debuggers
+// connect to.
+func (s *Server) WebSocketURL() string {
+	return fmt.Sprintf("ws://%s/%s", s.ln.Addr(), s.id)
+}
+
+// DevToolsURL returns a URL that opens Chrome DevTools connected to the
+// server when pasted into Chrome's address bar.
+func (s *Server) DevToolsURL() string {
+	return fmt.Sprintf("devtools://devtools/bundled/js_app.html?experiments=true&v8only=true&ws=%s/%s",
+		s.ln.Addr(), s.id)
+}
+
+// WaitForDebugger waits until a debugger is attached and asks to run the
+// javascript, which DevTools does once it's ready, or until ctx is done.
+func (s *Server) WaitForDebugger(ctx context.Context) error {
+	select {
+	case <-s.started:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PauseOnNextStatement makes the javascript pause before the next statement
+// that runs, if a debugger is attached.
+func (s *Server) PauseOnNextStatement() error {
+	s.mu.Lock()
+	in := s.in
+	s.mu.Unlock()
+	if in == nil {
+		return errors.New("No debugger is attached")
+	}
+	return in.PauseOnNextStatement("Break on start")
+}
+
+// ForwardConsole makes the Context's console methods, e.g. as injected by
+// v8console, also call V8's built-in console, which shows the messages in the
+// debugger.
+func (s *Server) ForwardConsole() error {
+	forward, err := s.ctx.Eval(`(function(builtin, console) {
+		Object.keys(builtin).forEach(function(name) {
+			var method = console[name];
+			if (method === builtin[name]) {
+				return;
+			}
+			console[name] = function() {
+				builtin[name].apply(null, arguments);
+				if (typeof method === 'function') {
+					return method.apply(this, arguments);
+				}
+			};
+		});
+	})`, "<inspector>")
+	if err != nil {
+		return err
+	}
+	console, err := s.ctx.Global().Get("console")
+	if err != nil {
+		return err
+	}
+	_, err = forward.Call(nil, s.console, console)
+	return err
+}
+
+// Close stops the server and detaches the debugger, if any.
+func (s *Server) Close() error {
+	err := s.http.Close()
+	s.mu.Lock()
+	conn := s.conn
+	s.mu.Unlock()
+	if conn != nil {
+		conn.Close() // serveWebSocket closes the inspector
+	}
+	return err
+}
+
+// target describes the debugging target in the /json/list response.
+type target struct {
+	Description          string `json:"description"`
+	DevtoolsFrontendURL  string `json:"devtoolsFrontendUrl"`
+	ID                   string `json:"id"`
+	Title                string `json:"title"`
+	Type                 string `json:"type"`
+	URL                  string `json:"url"`
+	WebSocketDebuggerURL string `json:"webSocketDebuggerUrl,omitempty"`
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request) {
+	t := target{
+		Description:         "v8 context",
+		DevtoolsFrontendURL: s.DevToolsURL(),
+		ID:                  s.id,
+		Title:               "v8",
+		Type:                "node",
+		URL:                 "file://",
+	}
+	s.mu.Lock()
+	if s.conn == nil {
+		// Like node, only advertise the WebSocket while it's available.
+		t.WebSocketDebuggerURL = s.WebSocketURL()
+	}
+	s.mu.Unlock()
+	writeJSON(w, []target{t})
+}
+
+func (s *Server) serveVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{
+		"Browser":          "v8",
+		"Protocol-Version": "1.3",
+		"V8-Version": fmt.Sprintf("%d.%d.%d.%d",
+			v8.Version.Major, v8.Version.Minor, v8.Version.Build, v8.Version.Patch),
+	})
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !allowedOrigin(r.Header.Get("Origin")) {
+		http.Error(w, "Origin is not allowed", http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	busy := s.conn != nil
+	s.mu.Unlock()
+	if busy {
+		http.Error(w, "A debugger is already attached", http.StatusServiceUnavailable)
+		return
+	}
+	conn, err := acceptWebSocket(w, r)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.conn != nil {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conn = conn
+	s.mu.Unlock()
+
+	in := v8.NewInspector(s.ctx, &session{s, conn})
+	s.mu.Lock()
+	s.in = in
+	s.mu.Unlock()
+
+	for {
+		msg, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		in.Dispatch(string(msg))
+	}
+
+	// Only the first Inspector of the isolate dispatches messages while the
+	// javascript is paused, so close it before accepting another debugger.
+	conn.Close()
+	in.Close()
+	s.mu.Lock()
+	s.conn = nil
+	s.in = nil
+	s.mu.Unlock()
+}
+
+// session connects an Inspector to a debugger's WebSocket.
+type session struct {
+	s    *Server
+	conn *wsConn
+}
+
+func (ss *session) Send(msg string) {
+	// Errors show up when reading from the connection, which closes the
+	// Inspector.
+	ss.conn.WriteMessage([]byte(msg))
+}
+
+func (ss *session) RunIfWaitingForDebugger() {
+	ss.s.mu.Lock()
+	defer ss.s.mu.Unlock()
+	select {
+	case <-ss.s.started:
+	default:
+		close(ss.s.started)
+	}
+}
+
+// checkHost rejects the requests whose Host isn't localhost or an IP address.
+// A web page that rebinds its domain to the server's address can send
+// requests, but with its own domain as the Host.
+func checkHost(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedHost(r.Host) {
+			http.Error(w, "Host is not localhost or an IP address", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func allowedHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	return strings.EqualFold(host, "localhost") || net.ParseIP(host) != nil
+}
+
+// allowedOrigin returns whether a WebSocket may be opened from the Origin.
+// Browsers send the Origin of the page that opens the WebSocket, so only
+// DevTools' own pages and clients that send none, which aren't pages, are
+// allowed.
+func allowedOrigin(origin string) bool {
+	return origin == "" ||
+		strings.HasPrefix(origin, "devtools://") ||
+		strings.HasPrefix(origin, "chrome-devtools://")
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// newId returns a random UUID, which is the form of id that DevTools expects.
+func newId() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,272 @@
+package inspector
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/augustoroman/v8"
+)
+
+func TestServer(t *testing.T) {
+	ctx := v8.NewIsolate().NewContext()
+	server, err := NewServer(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/json/list", server.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []target
+	err = json.NewDecoder(resp.Body).Decode(&targets)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].WebSocketDebuggerURL != server.WebSocketURL() {
+		t.Fatalf("Wrong targets: %#v", targets)
+	}
+
+	c := dialDebugger(t, server.WebSocketURL())
+	defer c.conn.Close()
+
+	c.send("Runtime.enable", nil)
+	c.send("Debugger.enable", nil)
+	c.send("Runtime.runIfWaitingForDebugger", nil)
+	waitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.WaitForDebugger(waitCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	res := c.call("Runtime.evaluate", map[string]interface{}{"expression": "1 + 2"})
+	if !strings.Contains(string(res), `"value":3`) {
+		t.Errorf("Wrong evaluation result: %s", res)
+	}
+
+	// Pause at a debugger statement, inspect the scope and resume.
+	done := make(chan error, 1)
+	go func() {
+		_, err := ctx.Eval(`
+			function add(a, b) {
+				var sum = a + b;
+				debugger;
+				return sum;
+			}
+			add(40, 2);
+		`, "add.js")
+		done <- err
+	}()
+	paused := c.waitFor("Debugger.paused")
+	var params struct {
+		CallFrames []struct {
+			CallFrameID  string `json:"callFrameId"`
+			FunctionName string `json:"functionName"`
+		} `json:"callFrames"`
+	}
+	if err := json.Unmarshal(paused, &params); err != nil {
+		t.Fatal(err)
+	}
+	if len(params.CallFrames) == 0 || params.CallFrames[0].FunctionName != "add" {
+		t.Fatalf("Wrong call frames: %s", paused)
+	}
+	res = c.call("Debugger.evaluateOnCallFrame", map[string]interface{}{
+		"callFrameId": params.CallFrames[0].CallFrameID,
+		"expression":  "sum",
+	})
+	if !strings.Contains(string(res), `"value":42`) {
+		t.Errorf("Wrong scope value: %s", res)
+	}
+	c.send("Debugger.resume", nil)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The javascript didn't resume")
+	}
+
+	// The built-in console shows up in the debugger.
+	if err := server.ForwardConsole(); err != nil {
+		t.Fatal(err)
+	}
+	go ctx.Eval(`console.log('hello debugger')`, "log.js")
+	if msg := c.waitFor("Runtime.consoleAPICalled"); !strings.Contains(string(msg), "hello debugger") {
+		t.Errorf("Wrong console message: %s", msg)
+	}
+}
+
+func TestServerRejectsWebPages(t *testing.T) {
+	ctx := v8.NewIsolate().NewContext()
+	server, err := NewServer(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	get := func(path, host string, header http.Header) int {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%s%s", server.Addr(), path), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host != "" {
+			req.Host = host
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+	for host, status := range map[string]int{
+		"":                         http.StatusOK,
+		"localhost:" + port:        http.StatusOK,
+		"LOCALHOST":                http.StatusOK,
+		"[::1]:" + port:            http.StatusOK,
+		"evil.example.com:" + port: http.StatusForbidden,
+		"localhost.example.com":    http.StatusForbidden,
+	} {
+		if got := get("/json/list", host, nil); got != status {
+			t.Errorf("Expected %d for Host %q, got %d", status, host, got)
+		}
+	}
+
+	wsPath := strings.TrimPrefix(server.WebSocketURL(), "ws://"+server.Addr().String())
+	upgrade := http.Header{
+		"Connection":            {"Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+		"Sec-Websocket-Version": {"13"},
+	}
+	if got := get(wsPath, "evil.example.com:"+port, upgrade); got != http.StatusForbidden {
+		t.Errorf("Expected the WebSocket to be forbidden for a rebound Host, got %d", got)
+	}
+	upgrade.Set("Origin", "http://evil.example.com")
+	if got := get(wsPath, "", upgrade); got != http.StatusForbidden {
+		t.Errorf("Expected the WebSocket to be forbidden for a web page, got %d", got)
+	}
+
+	// DevTools itself may still connect.
+	c := dialDebugger(t, server.WebSocketURL())
+	c.conn.Close()
+}
+
+// debugger is a minimal Chrome DevTools Protocol client.
+type debugger struct {
+	t      *testing.T
+	conn   *wsConn
+	nextId int
+}
+
+func dialDebugger(t *testing.T, url string) *debugger {
+	conn, err := dialWebSocket(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &debugger{t: t, conn: conn}
+}
+
+func (d *debugger) send(method string, params interface{}) int {
+	d.nextId++
+	msg, _ := json.Marshal(map[string]interface{}{"id": d.nextId, "method": method, "params": params})
+	if err := d.conn.WriteMessage(msg); err != nil {
+		d.t.Fatal(err)
+	}
+	return d.nextId
+}
+
+// call sends a request and returns the result of its response.
+func (d *debugger) call(method string, params interface{}) json.RawMessage {
+	id := d.send(method, params)
+	for {
+		var msg struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+		}
+		d.read(&msg)
+		if msg.ID == id {
+			return msg.Result
+		}
+	}
+}
+
+// waitFor returns the params of the next notification of the method.
+func (d *debugger) waitFor(method string) json.RawMessage {
+	for {
+		var msg struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		d.read(&msg)
+		if msg.Method == method {
+			return msg.Params
+		}
+	}
+}
+
+func (d *debugger) read(v interface{}) {
+	data, err := d.conn.ReadMessage()
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+// dialWebSocket connects to the WebSocket at the ws:// url.
+func dialWebSocket(url string) (*wsConn, error) {
+	if !strings.HasPrefix(url, "ws://") {
+		return nil, fmt.Errorf("Unsupported WebSocket url %q", url)
+	}
+	hostPath := strings.TrimPrefix(url, "ws://")
+	host, path := hostPath, "/"
+	if i := strings.Index(hostPath, "/"); i >= 0 {
+		host, path = hostPath[:i], hostPath[i:]
+	}
+	conn, err := net.Dial("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\n"+
+		"Host: %s\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n", path, host, key)
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake failed: %s", resp.Status)
+	}
+	return &wsConn{conn: conn, r: r, client: true}, nil
+}
@@ -5,7 +5,6 @@ package v8
 //   https://developers.google.com/v8/embed#exceptions
 //   https://docs.google.com/document/d/1g8JFi8T_oAE_7uAri7Njtig7fKaPDfotU6huOa1alds/edit
 // TODO:
-//   Value.Export(v) --> inverse of Context.Create()
 //   Proxy objects
 
 // BUG(aroman) Unhandled promise rejections are silently dropped
@@ -19,6 +18,7 @@ package v8
 import "C"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"runtime"
@@ -99,10 +99,21 @@ var v8_init_once sync.Once
 
 // Snapshot contains the stored VM state that can be used to quickly recreate a
 // new VM at that particular state.
-type Snapshot struct{ data C.StartupData }
+type Snapshot struct {
+	data C.StartupData
+
+	// callbacks are the Go callbacks that the snapshot's functions refer to.
+	callbacks map[string]Callback
+
+	// contexts are the indexes of the named contexts in the snapshot data.
+	contexts map[string]int
+
+	// codeKept is whether the snapshot data contains compiled functions.
+	codeKept bool
+}
 
 func newSnapshot(data C.StartupData) *Snapshot {
-	s := &Snapshot{data}
+	s := &Snapshot{data: data}
 	runtime.SetFinalizer(s, (*Snapshot).release)
 	return s
 }
@@ -116,26 +127,13 @@ func (s *Snapshot) release() {
 	runtime.SetFinalizer(s, nil)
 }
 
-// Export returns the VM state data as a byte slice.
-func (s *Snapshot) Export() []byte {
-	return []byte(C.GoStringN(s.data.ptr, s.data.len))
-}
-
-// RestoreSnapshotFromExport creates a Snapshot from a byte slice that should
-// have previous come from Snapshot.Export().
-func RestoreSnapshotFromExport(data []byte) *Snapshot {
-	str := C.String{
-		ptr: (*C.char)(C.malloc(C.size_t(len(data)))),
-		len: C.int(len(data)),
-	}
-	C.memcpy(unsafe.Pointer(str.ptr), unsafe.Pointer(&data[0]), C.size_t(len(data)))
-	return newSnapshot(str)
-}
-
 // CreateSnapshot creates a new Snapshot after running the supplied JS code.
 // Because Snapshots cannot have refences to external code (no Go callbacks),
 // all of the initialization code must be pure JS and supplied at once as the
 // arg to this function.
+//
+// If the code throws, CreateSnapshot silently returns an unusable Snapshot.
+// Use CreateSnapshotE instead to get the exception.
 func CreateSnapshot(js string) *Snapshot {
 	v8_init_once.Do(func() { C.v8_init() })
 	js_ptr := C.CString(js)
@@ -143,44 +141,136 @@ func CreateSnapshot(js string) *Snapshot {
 	return newSnapshot(C.v8_CreateSnapshotDataBlob(js_ptr))
 }
 
+// CreateSnapshotE is like CreateSnapshot, but if the code throws it returns a
+// *JSError with the exception's message, location and stack trace instead of
+// a Snapshot. The JSError has no Value since the snapshot's isolate is gone.
+func CreateSnapshotE(js string) (*Snapshot, error) {
+	return NewSnapshotBuilder().Create(js)
+}
+
 // Isolate represents a single-threaded V8 engine instance.  It can run multiple
 // independent Contexts and V8 values can be freely shared between the Contexts,
 // however only one context will ever execute at a time.
+//
+// An Isolate and its Contexts and Values may be used from multiple goroutines:
+// every call locks the isolate, so concurrent calls are serialized. Use Do to
+// run several calls without any other goroutine's calls in between.
 type Isolate struct {
 	ptr C.IsolatePtr
 	s   *Snapshot // make sure not to be advanced GC
+
+	// settled is closed and replaced whenever a Resolver settles a promise in
+	// this isolate so that everybody awaiting a promise can check again.
+	settledMutex sync.Mutex
+	settled      chan struct{}
+
+	gcCallbacksId int // of the callbacks added by OnGC, 0 if none; guarded by gcCallbacksMutex
+
+	coverageMutex sync.Mutex
+	coverage      *coverage // while precise coverage is collected
+}
+
+// ErrHeapLimitExceeded is returned when javascript execution was terminated
+// because the isolate's heap was about to exceed its limit.
+var ErrHeapLimitExceeded = errors.New("Heap limit exceeded")
+
+// IsolateOptions configures a new Isolate. Zero values use V8's defaults.
+type IsolateOptions struct {
+	// Snapshot, if not nil, is used to initialize all Contexts created from
+	// the Isolate.
+	Snapshot *Snapshot
+	// MaxHeapBytes limits the size of the old generation of the heap, which
+	// holds most long-lived objects. It is rounded up to whole megabytes.
+	MaxHeapBytes int
+	// MaxYoungGenBytes limits the size of the young generation of the heap,
+	// where new objects are allocated.
+	MaxYoungGenBytes int
+	// StackLimit is the number of bytes of the calling thread's stack that
+	// javascript may use before a RangeError is thrown. It must be smaller
+	// than the stack of the threads that call into V8, typically 8MB.
+	StackLimit int
 }
 
 // NewIsolate creates a new V8 Isolate.
 func NewIsolate() *Isolate {
-	v8_init_once.Do(func() { C.v8_init() })
-	iso := &Isolate{ptr: C.v8_Isolate_New(C.StartupData{ptr: nil, len: 0})}
-	runtime.SetFinalizer(iso, (*Isolate).release)
-	return iso
+	return NewIsolateWithOptions(IsolateOptions{})
 }
 
 // NewIsolateWithSnapshot creates a new V8 Isolate using the supplied Snapshot
 // to initialize all Contexts created from this Isolate.
 func NewIsolateWithSnapshot(s *Snapshot) *Isolate {
+	return NewIsolateWithOptions(IsolateOptions{Snapshot: s})
+}
+
+// NewIsolateWithOptions creates a new V8 Isolate with the specified options.
+//
+// When the heap is about to exceed its limit, V8 would normally abort the
+// whole process. Instead, the running javascript is terminated and the
+// Eval, Call, etc. that started it returns ErrHeapLimitExceeded. The isolate
+// may be used again afterwards, but if the memory is still referenced (e.g. by
+// a global variable) it's best to discard the isolate. This requires V8 6.7 or
+// later.
+func NewIsolateWithOptions(opts IsolateOptions) *Isolate {
 	v8_init_once.Do(func() { C.v8_init() })
-	iso := &Isolate{ptr: C.v8_Isolate_New(s.data), s: s}
+	data := C.StartupData{ptr: nil, len: 0}
+	if opts.Snapshot != nil {
+		data = opts.Snapshot.data
+	}
+	iso := &Isolate{
+		ptr: C.v8_Isolate_New(data, C.IsolateOptions{
+			MaxHeapBytes:     C.size_t(opts.MaxHeapBytes),
+			MaxYoungGenBytes: C.size_t(opts.MaxYoungGenBytes),
+			StackLimit:       C.size_t(opts.StackLimit),
+		}),
+		s:       opts.Snapshot,
+		settled: make(chan struct{}),
+	}
 	runtime.SetFinalizer(iso, (*Isolate).release)
 	return iso
 }
 
 // NewContext creates a new, clean V8 Context within this Isolate.
 func (i *Isolate) NewContext() *Context {
-	ctx := &Context{
-		iso:       i,
-		ptr:       C.v8_Isolate_NewContext(i.ptr),
-		callbacks: map[int]callbackInfo{},
+	return i.newContext(func(id C.int) C.ContextPtr {
+		return C.v8_Isolate_NewContext(i.ptr, id)
+	})
+}
+
+// NewContextFromSnapshot creates a new javascript context from the named
+// context of the Isolate's snapshot, which must have been added with
+// SnapshotBuilder.AddContext.
+func (i *Isolate) NewContextFromSnapshot(name string) (*Context, error) {
+	index, ok := 0, false
+	if i.s != nil {
+		index, ok = i.s.contexts[name]
 	}
+	if !ok {
+		return nil, fmt.Errorf("Cannot find context %q in the isolate's snapshot", name)
+	}
+	ctx := i.newContext(func(id C.int) C.ContextPtr {
+		return C.v8_Isolate_NewContextFromSnapshot(i.ptr, C.int(index), id)
+	})
+	if ctx.ptr == nil {
+		ctx.release()
+		return nil, fmt.Errorf("Cannot create context %q from the isolate's snapshot", name)
+	}
+	return ctx, nil
+}
 
+func (i *Isolate) newContext(create func(id C.int) C.ContextPtr) *Context {
 	contextsMutex.Lock()
 	nextContextId++
-	ctx.id = nextContextId
+	id := nextContextId
 	contextsMutex.Unlock()
 
+	ctx := &Context{
+		id:        id,
+		iso:       i,
+		ptr:       create(C.int(id)),
+		callbacks: map[int]callbackInfo{},
+		modules:   map[string]C.ModulePtr{},
+	}
+
 	runtime.SetFinalizer(ctx, (*Context).release)
 
 	return ctx
@@ -190,8 +280,77 @@ func (i *Isolate) NewContext() *Context {
 // Contexts that are executing.  This may be called from any goroutine at any
 // time.
 func (i *Isolate) Terminate() { C.v8_Isolate_Terminate(i.ptr) }
+
+// Do calls f while holding the isolate's lock, so that no other goroutine can
+// use the isolate, or any of its Contexts and Values, until f returns. The
+// calls that f makes on the current goroutine, including those of Go callbacks
+// called from javascript, proceed as usual. Do may be nested.
+//
+// f must not wait for other goroutines that use the isolate: they are blocked
+// until f returns, so that would deadlock.
+func (i *Isolate) Do(f func()) {
+	// The lock belongs to the OS thread, so the goroutine must stay on it.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	locker := C.v8_Isolate_Lock(i.ptr)
+	defer C.v8_Isolate_Unlock(locker)
+	f()
+}
+
+// doUntilDone calls f within Do and terminates the javascript that f runs if
+// ctx is done before f returns. Since no other goroutine can use the isolate
+// until Do returns, only f's javascript is terminated, and the termination is
+// cancelled before Do returns so that the isolate can be used again.
+func (i *Isolate) doUntilDone(ctx context.Context, f func()) {
+	if ctx.Done() == nil {
+		f()
+		return
+	}
+	i.Do(func() {
+		finished := make(chan struct{})
+		terminated := make(chan bool, 1)
+		go func() {
+			select {
+			case <-ctx.Done():
+				i.Terminate()
+				terminated <- true
+			case <-finished:
+				terminated <- false
+			}
+		}()
+		f()
+		close(finished)
+		if <-terminated {
+			C.v8_Isolate_CancelTerminate(i.ptr)
+		}
+	})
+}
+
+// TerminatedError is returned by EvalContext, CallContext and Await when the
+// javascript was terminated because the context.Context was done. Err is the
+// context's error, i.e. context.Canceled or context.DeadlineExceeded, so
+// errors.Is may be used to check for those.
+type TerminatedError struct {
+	Err error
+}
+
+func (e *TerminatedError) Error() string { return "Execution terminated: " + e.Err.Error() }
+func (e *TerminatedError) Unwrap() error { return e.Err }
+
+// terminatedError converts err into a *TerminatedError if it's caused by goctx
+// being done.
+func terminatedError(goctx context.Context, err error) error {
+	var jsErr *JSError
+	if goctx.Err() != nil && errors.As(err, &jsErr) && jsErr.Value == nil {
+		return &TerminatedError{goctx.Err()}
+	}
+	return err
+}
+
 func (i *Isolate) release() {
+	i.releaseInterrupts()
 	C.v8_Isolate_Release(i.ptr)
+	i.releaseGCCallbacks()
 	i.ptr = nil
 	runtime.SetFinalizer(i, nil)
 }
@@ -213,9 +372,17 @@ type Context struct {
 	id  int
 	iso *Isolate
 	ptr C.ContextPtr
+	// releaseMutex keeps ptr from being released while the finalizers of
+	// the Context's Values and Scripts release them, which may happen after
+	// a Pool released the Context and its isolate.
+	releaseMutex sync.RWMutex
 
+	mu             sync.Mutex // guards callbacks and nextCallbackId
 	callbacks      map[int]callbackInfo
 	nextCallbackId int
+
+	modules        map[string]C.ModulePtr
+	moduleResolver ModuleResolver
 }
 type callbackInfo struct {
 	Callback
@@ -223,7 +390,7 @@ type callbackInfo struct {
 }
 
 func (ctx *Context) split(ret C.ValueTuple) (*Value, error) {
-	return ctx.newValue(ret.Value, ret.Kinds), ctx.iso.convertErrorMsg(ret.error_msg)
+	return ctx.newValue(ret.Value, ret.Kinds), ctx.convertError(ret.error_msg, ret.exception)
 }
 
 // Eval runs the javascript code in the VM.  The filename parameter is
@@ -239,6 +406,28 @@ func (ctx *Context) Eval(jsCode, filename string) (*Value, error) {
 	return ctx.split(ret)
 }
 
+// EvalContext is like Eval, but terminates the javascript if goctx is done
+// before it finishes, e.g. because of a deadline:
+//
+//     goctx, cancel := context.WithTimeout(context.Background(), time.Second)
+//     defer cancel()
+//     res, err := ctx.EvalContext(goctx, untrustedCode, "untrusted.js")
+//     if errors.Is(err, context.DeadlineExceeded) {
+//         ...
+//     }
+//
+// In that case the returned error is a *TerminatedError wrapping goctx.Err()
+// and the isolate may continue to be used.
+func (ctx *Context) EvalContext(goctx context.Context, jsCode, filename string) (*Value, error) {
+	if err := goctx.Err(); err != nil {
+		return nil, &TerminatedError{err}
+	}
+	var res *Value
+	var err error
+	ctx.iso.doUntilDone(goctx, func() { res, err = ctx.Eval(jsCode, filename) })
+	return res, terminatedError(goctx, err)
+}
+
 // Bind creates a V8 function value that calls a Go function when invoked. This
 // value is created but NOT visible in the Context until it is explicitly passed
 // to the Context (either via a .Set() call or as a callback return value).
@@ -258,9 +447,11 @@ func (ctx *Context) Eval(jsCode, filename string) (*Value, error) {
 // more memory each time. Normally this isn't a problem, but many many Bind's
 // on a Context can gradually consume memory.
 func (ctx *Context) Bind(name string, cb Callback) *Value {
+	ctx.mu.Lock()
 	ctx.nextCallbackId++
 	id := ctx.nextCallbackId
 	ctx.callbacks[id] = callbackInfo{cb, name}
+	ctx.mu.Unlock()
 	cbIdStr := C.CString(fmt.Sprintf("%d:%d", ctx.id, id))
 	defer C.free(unsafe.Pointer(cbIdStr))
 	nameStr := C.CString(name)
@@ -277,10 +468,12 @@ func (ctx *Context) Global() *Value {
 	return ctx.newValue(C.v8_Context_Global(ctx.ptr), C.KindMask(KindObject))
 }
 func (ctx *Context) release() {
+	ctx.releaseMutex.Lock()
 	if ctx.ptr != nil {
 		C.v8_Context_Release(ctx.ptr)
 	}
 	ctx.ptr = nil
+	ctx.releaseMutex.Unlock()
 
 	contextsMutex.Lock()
 	delete(contexts, ctx.id)
@@ -329,8 +522,10 @@ type Value struct {
 }
 
 // Bytes returns a byte slice extracted from this value when the value
-// is of type ArrayBuffer. The returned byte slice is copied from the underlying
-// buffer, so modifying it will not be reflected in the VM.
+// is of type ArrayBuffer or ArrayBufferView (typed arrays and DataViews). For
+// views, only the bytes visible through the view are returned. The returned
+// byte slice is copied from the underlying buffer, so modifying it will not be
+// reflected in the VM.
 // Values of other types return nil.
 func (v *Value) Bytes() []byte {
 	mem := C.v8_Value_Bytes(v.ctx.ptr, v.ptr)
@@ -416,16 +611,17 @@ func (v *Value) GetIndex(idx int) (*Value, error) {
 // will fail.
 func (v *Value) Set(name string, value *Value) error {
 	name_cstr := C.CString(name)
-	errmsg := C.v8_Value_Set(v.ctx.ptr, v.ptr, name_cstr, value.ptr)
+	ret := C.v8_Value_Set(v.ctx.ptr, v.ptr, name_cstr, value.ptr)
 	C.free(unsafe.Pointer(name_cstr))
-	return v.ctx.iso.convertErrorMsg(errmsg)
+	_, err := v.ctx.split(ret)
+	return err
 }
 
 // SetIndex sets the object's value at the specified index.  If this value is
 // not an object or an array, this will fail.
 func (v *Value) SetIndex(idx int, value *Value) error {
-	return v.ctx.iso.convertErrorMsg(
-		C.v8_Value_SetIdx(v.ctx.ptr, v.ptr, C.int(idx), value.ptr))
+	_, err := v.ctx.split(C.v8_Value_SetIdx(v.ctx.ptr, v.ptr, C.int(idx), value.ptr))
+	return err
 }
 
 // Call this value as a function.  If this value is not a function, this will
@@ -446,6 +642,19 @@ func (v *Value) Call(this *Value, args ...*Value) (*Value, error) {
 	return v.ctx.split(result)
 }
 
+// CallContext is like Call, but terminates the function if goctx is done
+// before it returns. In that case the returned error is a *TerminatedError
+// wrapping goctx.Err() and the isolate may continue to be used.
+func (v *Value) CallContext(goctx context.Context, this *Value, args ...*Value) (*Value, error) {
+	if err := goctx.Err(); err != nil {
+		return nil, &TerminatedError{err}
+	}
+	var res *Value
+	var err error
+	v.ctx.iso.doUntilDone(goctx, func() { res, err = v.Call(this, args...) })
+	return res, terminatedError(goctx, err)
+}
+
 // IsKind will test whether the underlying value is the specified JS kind.
 // The kind of a value is set when the value is created and will not change.
 func (v *Value) IsKind(k Kind) bool {
@@ -468,7 +677,11 @@ func (v *Value) New(args ...*Value) (*Value, error) {
 
 func (v *Value) release() {
 	if v.ptr != nil {
-		C.v8_Value_Release(v.ctx.ptr, v.ptr)
+		v.ctx.releaseMutex.RLock()
+		if v.ctx.ptr != nil {
+			C.v8_Value_Release(v.ctx.ptr, v.ptr)
+		}
+		v.ctx.releaseMutex.RUnlock()
 	}
 	v.ctx = nil
 	v.ptr = nil
@@ -566,21 +779,30 @@ func go_callback_handler(
 	cbId := C.GoStringN(cbIdStr.ptr, cbIdStr.len)
 	parts := strings.SplitN(cbId, ":", 2)
 	ctxId, _ := strconv.Atoi(parts[0])
-	callbackId, _ := strconv.Atoi(parts[1])
 
 	contextsMutex.RLock()
 	ref := contexts[ctxId]
+	contextsMutex.RUnlock()
 	if ref == nil {
-		panic(fmt.Errorf(
-			"Missing context pointer during callback for context #%d", ctxId))
+		// The javascript wasn't started by a Go call on this callback's
+		// Context, e.g. a microtask that Await runs for another Context.
+		errmsg := fmt.Sprintf("Cannot call a Go callback of context #%d outside of a Go call on that context", ctxId)
+		return C.ValueTuple{error_msg: C.Error{ptr: C.CString(errmsg), len: C.int(len(errmsg))}}
 	}
 	ctx := ref.ptr
-	contextsMutex.RUnlock()
 
-	info := ctx.callbacks[int(callbackId)]
-	if info.Callback == nil {
-		// Everything is bad -- this should never happen.
-		panic(fmt.Errorf("No such registered callback: %s", info.name))
+	var info callbackInfo
+	if strings.HasPrefix(parts[1], "@") {
+		info = ctx.iso.snapshotCallback(parts[1][1:])
+	} else {
+		callbackId, _ := strconv.Atoi(parts[1])
+		ctx.mu.Lock()
+		info = ctx.callbacks[callbackId]
+		ctx.mu.Unlock()
+		if info.Callback == nil {
+			// Everything is bad -- this should never happen.
+			panic(fmt.Errorf("No such registered callback: %s", info.name))
+		}
 	}
 
 	// Convert array of args into a slice.  See:
@@ -609,7 +831,7 @@ func go_callback_handler(
 	if err != nil {
 		errmsg := err.Error()
 		e := C.Error{ptr: C.CString(errmsg), len: C.int(len(errmsg))}
-		return C.ValueTuple{nil, 0, e}
+		return C.ValueTuple{error_msg: e}
 	}
 
 	if res == nil {
@@ -617,7 +839,7 @@ func go_callback_handler(
 	} else if res.ctx.iso.ptr != ctx.iso.ptr {
 		errmsg := fmt.Sprintf("Callback %s returned a value from another isolate.", info.name)
 		e := C.Error{ptr: C.CString(errmsg), len: C.int(len(errmsg))}
-		return C.ValueTuple{nil, 0, e}
+		return C.ValueTuple{error_msg: e}
 	}
 
 	return C.ValueTuple{Value: res.ptr}
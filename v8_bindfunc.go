@@ -0,0 +1,92 @@
+package v8
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// BindFunc creates a V8 function value that calls an arbitrary Go function when
+// invoked. Like Bind, the value is NOT visible in the Context until it is
+// explicitly passed to the Context.
+//
+// Unlike Bind, fn may be any Go function, for example:
+//
+//     func(name string, n int) (Result, error)
+//
+// The JS arguments are converted into the function's parameter types using
+// Value.Unmarshal; missing arguments are passed as zero values and extra
+// arguments are ignored unless the function is variadic. Parameters of type
+// *v8.Value receive the JS argument as-is.
+//
+// The function may return at most one value plus an optional trailing error.
+// The value is converted back into JS using Context.Create, and a non-nil
+// error is thrown as an exception. If fn is convertible to a Callback, this is
+// equivalent to Bind.
+func (ctx *Context) BindFunc(name string, fn interface{}) (*Value, error) {
+	cb, err := funcToCallback(reflect.ValueOf(fn))
+	if err != nil {
+		return nil, err
+	}
+	return ctx.Bind(name, cb), nil
+}
+
+func funcToCallback(fn reflect.Value) (Callback, error) {
+	if fn.Kind() != reflect.Func {
+		return nil, fmt.Errorf("Not a func: %s", fn.Type())
+	} else if fn.IsNil() {
+		return nil, fmt.Errorf("Func is nil: %s", fn.Type())
+	} else if fn.Type().ConvertibleTo(callbackType) {
+		return fn.Convert(callbackType).Interface().(Callback), nil
+	}
+
+	t := fn.Type()
+	numOut := t.NumOut()
+	returnsErr := numOut > 0 && t.Out(numOut-1) == errorType
+	if returnsErr {
+		numOut--
+	}
+	if numOut > 1 {
+		return nil, fmt.Errorf("Func must return at most one value and an error: %s", t)
+	}
+
+	return func(in CallbackArgs) (*Value, error) {
+		numFixed := t.NumIn()
+		if t.IsVariadic() {
+			numFixed--
+		}
+
+		args := make([]reflect.Value, 0, len(in.Args))
+		for i := 0; i < numFixed; i++ {
+			arg := reflect.New(t.In(i)).Elem()
+			if err := in.Arg(i).unmarshal(arg, nil); err != nil {
+				return nil, fmt.Errorf("argument %d: %v", i, err)
+			}
+			args = append(args, arg)
+		}
+		if t.IsVariadic() {
+			elemType := t.In(numFixed).Elem()
+			for i := numFixed; i < len(in.Args); i++ {
+				arg := reflect.New(elemType).Elem()
+				if err := in.Args[i].unmarshal(arg, nil); err != nil {
+					return nil, fmt.Errorf("argument %d: %v", i, err)
+				}
+				args = append(args, arg)
+			}
+		}
+
+		out := fn.Call(args)
+
+		if returnsErr {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return nil, err.Interface().(error)
+			}
+			out = out[:len(out)-1]
+		}
+		if len(out) == 0 {
+			return nil, nil
+		}
+		return in.Context.Create(out[0].Interface())
+	}, nil
+}
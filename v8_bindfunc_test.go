@@ -0,0 +1,102 @@
+package v8
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBindFunc(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	type Result struct {
+		Greeting string `json:"greeting"`
+		Count    int    `json:"count"`
+	}
+
+	fns := map[string]interface{}{
+		"greet": func(name string, n int) (Result, error) {
+			if n < 0 {
+				return Result{}, errors.New("negative count")
+			}
+			return Result{"Hello " + name, n}, nil
+		},
+		"sum": func(nums ...float64) float64 {
+			total := 0.0
+			for _, n := range nums {
+				total += n
+			}
+			return total
+		},
+		"kind": func(v *Value) string { return v.kindMask.String() },
+		"noop": func() {},
+		"cb":   func(in CallbackArgs) (*Value, error) { return in.Context.Create("callback") },
+	}
+	for name, fn := range fns {
+		val, err := ctx.BindFunc(name, fn)
+		if err != nil {
+			t.Fatalf("Failed to bind %s: %v", name, err)
+		}
+		ctx.Global().Set(name, val)
+	}
+
+	var testcases = []struct {
+		js  string
+		str string
+	}{
+		{`JSON.stringify(greet("Alice", 3))`, `{"greeting":"Hello Alice","count":3}`},
+		{`JSON.stringify(greet("Bob"))`, `{"greeting":"Hello Bob","count":0}`},
+		{`sum(1, 2, 3.5)`, `6.5`},
+		{`sum()`, `0`},
+		{`kind([])`, `Array,Object`},
+		{`noop()`, `undefined`},
+		{`cb()`, `callback`},
+		{`try { greet("Carl", -1) } catch (e) { e.message }`, `negative count`},
+		{`try { greet(3) } catch (e) { e.message }`, `argument 0: expected string, got number`},
+	}
+
+	for i, test := range testcases {
+		res, err := ctx.Eval(test.js, "bindfunc.js")
+		if err != nil {
+			t.Errorf("%d %#q: Failed: %v", i, test.js, err)
+		} else if str := res.String(); str != test.str {
+			t.Errorf("%d %#q: Expected %q, got %q", i, test.js, test.str, str)
+		}
+	}
+}
+
+func TestBindFuncInvalid(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	var nilFunc func()
+	for i, fn := range []interface{}{
+		"not a func",
+		nilFunc,
+		func() (int, int) { return 1, 2 },
+	} {
+		if val, err := ctx.BindFunc("invalid", fn); err == nil {
+			t.Errorf("%d: Expected error binding %T, but got %v", i, fn, val)
+		}
+	}
+}
+
+func TestCreateBindsFuncs(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	api, err := ctx.Create(map[string]interface{}{
+		"upper": strings.ToUpper,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Global().Set("api", api)
+
+	if res, err := ctx.Eval(`api.upper("shout")`, "create.js"); err != nil {
+		t.Fatal(err)
+	} else if str := res.String(); str != "SHOUT" {
+		t.Errorf("Expected SHOUT, got %q", str)
+	}
+}
@@ -2,17 +2,25 @@
 
 #include "libplatform/libplatform.h"
 #include "v8.h"
+#include "v8-inspector.h"
+#include "v8-profiler.h"
 
+#include <algorithm>
 #include <cstdlib>
 #include <cstring>
+#include <map>
+#include <memory>
 #include <string>
 #include <sstream>
+#include <thread>
+#include <vector>
 #include <stdio.h>
 
 #define ISOLATE_SCOPE(iso) \
   v8::Isolate* isolate = (iso);                                                               \
   v8::Locker locker(isolate);                            /* Lock to current thread.        */ \
-  v8::Isolate::Scope isolate_scope(isolate);             /* Assign isolate to this thread. */
+  v8::Isolate::Scope isolate_scope(isolate);             /* Assign isolate to this thread. */ \
+  StackLimitScope stack_limit_scope(isolate);            /* Apply the stack limit, if any. */
 
 
 #define VALUE_SCOPE(ctxptr) \
@@ -23,16 +31,103 @@
 
 extern "C" ValueTuple go_callback_handler(
     String id, CallerInfo info, int argc, ValueTuple* argv);
+extern "C" void go_interrupt_handler(int id, int ctx_id, ContextPtr ctx);
+extern "C" void go_inspector_send(int id, String msg);
+extern "C" void go_inspector_pause(int id);
+extern "C" void go_inspector_quit(int id);
+extern "C" void go_inspector_run(int id);
+extern "C" void go_inspector_dispatch(int id);
+extern "C" int go_heap_snapshot_write(int id, char* data, int size);
+extern "C" void go_gc_handler(int id, GCEvent event);
+
+v8::Platform* platform = nullptr;
 
 // We only need one, it's stateless.
 auto allocator = v8::ArrayBuffer::Allocator::NewDefaultAllocator();
 
+typedef struct Module {
+  v8::Persistent<v8::Module> ptr;
+  // The modules that each of this module's import specifiers resolve to.
+  std::map<std::string, Module*> dependencies;
+} Module;
+
 typedef struct {
   v8::Persistent<v8::Context> ptr;
   v8::Isolate* isolate;
+  int id;                       // The id of the Go context.
+  std::vector<Module*> modules; // Released with the context.
 } Context;
 
+// The embedder data slot of each v8::Context that points back to our Context.
+const int kContextEmbedderDataIndex = 1;
+
+class InspectorClient;
+
+// IsolateData holds our per-isolate state in the isolate's data slot 0.
+typedef struct {
+  size_t stack_limit;         // Bytes of stack that may be used, 0 for V8's default.
+  int depth;                  // Number of nested StackLimitScopes.
+  bool heap_limit_exceeded;   // Set when execution was terminated by near_heap_limit.
+  size_t initial_heap_limit;
+  v8::CpuProfiler* cpu_profiler; // Created by the first CPU profile.
+  std::vector<std::string> cpu_profiles;  // The names of the profiles being recorded.
+  std::thread::id cpu_profile_thread;     // The thread they sample.
+  int gc_callbacks_id;        // Passed to go_gc_handler, 0 without GC callbacks.
+  double gc_start[kNumGCTypes];  // Of the running garbage collection of each type.
+  size_t gc_used_heap_size[kNumGCTypes];
+  std::vector<Context*> contexts;  // The contexts that have not been released.
+  InspectorClient* inspector_client;  // While the isolate has Inspectors.
+} IsolateData;
+
+IsolateData* isolate_data(v8::Isolate* isolate) {
+  return static_cast<IsolateData*>(isolate->GetData(0));
+}
+
+// StackLimitScope sets the isolate's stack limit relative to the stack of the
+// calling thread, since Go may call into the isolate from different threads.
+// Nested scopes (e.g. from Go callbacks calling back into javascript) keep the
+// limit of the outermost one.
+class StackLimitScope {
+ public:
+  explicit StackLimitScope(v8::Isolate* isolate) : data_(isolate_data(isolate)) {
+    if (data_ == nullptr) {
+      return;
+    }
+    if (data_->depth++ == 0 && data_->stack_limit > 0) {
+      char here;
+      isolate->SetStackLimit(reinterpret_cast<uintptr_t>(&here) - data_->stack_limit);
+    }
+  }
+  ~StackLimitScope() {
+    if (data_ != nullptr) {
+      data_->depth--;
+    }
+  }
+
+ private:
+  IsolateData* data_;
+};
+
+#if V8_MAJOR_VERSION > 6 || (V8_MAJOR_VERSION == 6 && V8_MINOR_VERSION >= 7)
+#define HAS_NEAR_HEAP_LIMIT_CALLBACK 1
+
+// near_heap_limit terminates the running javascript instead of letting V8
+// abort the whole process once the heap is full.
+size_t near_heap_limit(void* raw_isolate, size_t current_heap_limit, size_t initial_heap_limit) {
+  v8::Isolate* isolate = static_cast<v8::Isolate*>(raw_isolate);
+  IsolateData* data = isolate_data(isolate);
+  data->heap_limit_exceeded = true;
+  data->initial_heap_limit = initial_heap_limit;
+  isolate->TerminateExecution();
+  // Raise the limit so that V8 has some room to unwind the terminated
+  // execution. The initial limit is restored by
+  // v8_Isolate_TakeHeapLimitExceeded.
+  return current_heap_limit + initial_heap_limit / 2;
+}
+#endif
+
 typedef v8::Persistent<v8::Value> Value;
+typedef v8::Persistent<v8::UnboundScript> UnboundScript;
 
 String DupString(const v8::String::Utf8Value& src) {
   char* data = static_cast<char*>(malloc(src.length()));
@@ -162,13 +257,321 @@ std::string report_exception(v8::Isolate* isolate, v8::Local<v8::Context> ctx, v
   return ss.str();
 }
 
+CallerInfo frame_info(v8::Local<v8::StackFrame> frame) {
+  return (CallerInfo){
+    DupString(str(frame->GetFunctionName())),
+    DupString(str(frame->GetScriptName())),
+    frame->GetLineNumber(),
+    frame->GetColumn(),
+  };
+}
+
+StackTrace stack_trace(v8::Local<v8::StackTrace> trace) {
+  StackTrace res = {nullptr, 0};
+  if (!trace.IsEmpty() && trace->GetFrameCount() > 0) {
+    res.NumFrames = trace->GetFrameCount();
+    res.Frames = static_cast<CallerInfo*>(calloc(res.NumFrames, sizeof(CallerInfo)));
+    for (int i = 0; i < res.NumFrames; i++) {
+      res.Frames[i] = frame_info(trace->GetFrame(i));
+    }
+  }
+  return res;
+}
+
+Exception* capture_exception(v8::Isolate* isolate, v8::Local<v8::Context> ctx, v8::TryCatch& try_catch) {
+  Exception* ex = static_cast<Exception*>(calloc(1, sizeof(Exception)));
+
+  v8::Local<v8::Value> exception = try_catch.Exception();
+  if (!exception.IsEmpty() && !try_catch.HasTerminated()) {
+    ex->Value = static_cast<PersistentValuePtr>(new Value(isolate, exception));
+    ex->Kinds = v8_Value_KindsFromLocal(exception);
+
+    std::string message = str(exception);
+    if (exception->IsObject()) {
+      // Reading the properties may run arbitrary getters, so ignore anything
+      // they might throw.
+      v8::TryCatch inner_try_catch(isolate);
+      v8::Local<v8::Object> object = v8::Local<v8::Object>::Cast(exception);
+      v8::Local<v8::Value> val;
+      if (object->Get(ctx, v8::String::NewFromUtf8(isolate, "name")).ToLocal(&val) &&
+          val->IsString()) {
+        ex->Name = DupString(str(val));
+      }
+      if (object->Get(ctx, v8::String::NewFromUtf8(isolate, "message")).ToLocal(&val) &&
+          val->IsString()) {
+        message = str(val);
+      }
+    }
+    ex->Message = DupString(message);
+  }
+
+  v8::Local<v8::Message> msg = try_catch.Message();
+  if (!msg.IsEmpty()) {
+    ex->Location.Filename = DupString(str(msg->GetScriptResourceName()));
+    ex->Location.Line = msg->GetLineNumber(ctx).FromMaybe(0);
+    // Message columns are 0-based while stack frame columns are 1-based.
+    ex->Location.Column = msg->GetStartColumn(ctx).FromMaybe(-1) + 1;
+
+    v8::Local<v8::String> source_line;
+    if (msg->GetSourceLine(ctx).ToLocal(&source_line)) {
+      ex->SourceLine = DupString(str(source_line));
+    }
+
+    StackTrace stack = stack_trace(msg->GetStackTrace());
+    ex->Frames = stack.Frames;
+    ex->NumFrames = stack.NumFrames;
+  }
+
+  return ex;
+}
+
+// detached_exception is like capture_exception, but without the thrown value
+// for exceptions whose context or isolate doesn't outlive the call.
+Exception* detached_exception(v8::Isolate* isolate, v8::Local<v8::Context> ctx, v8::TryCatch& try_catch) {
+  Exception* ex = capture_exception(isolate, ctx, try_catch);
+  if (ex->Value != nullptr) {
+    Value* value = static_cast<Value*>(ex->Value);
+    value->Reset();
+    delete value;
+    ex->Value = nullptr;
+  }
+  return ex;
+}
+
+ValueTuple exception_tuple(v8::Isolate* isolate, v8::Local<v8::Context> ctx, v8::TryCatch& try_catch) {
+  return (ValueTuple){
+    nullptr,
+    0,
+    DupString(report_exception(isolate, ctx, try_catch)),
+    capture_exception(isolate, ctx, try_catch),
+  };
+}
+
+v8::MaybeLocal<v8::Module> resolve_module(v8::Local<v8::Context> context,
+                                          v8::Local<v8::String> specifier,
+                                          v8::Local<v8::Module> referrer) {
+  v8::Isolate* isolate = context->GetIsolate();
+  Context* ctx = static_cast<Context*>(
+      context->GetAlignedPointerFromEmbedderData(kContextEmbedderDataIndex));
+
+  for (Module* module : ctx->modules) {
+    if (module->ptr.Get(isolate) != referrer) {
+      continue;
+    }
+    auto dep = module->dependencies.find(str(specifier));
+    if (dep != module->dependencies.end()) {
+      return dep->second->ptr.Get(isolate);
+    }
+    break;
+  }
+
+  std::string msg = "Cannot resolve module \"" + str(specifier) + "\"";
+  isolate->ThrowException(v8::Exception::Error(v8::String::NewFromUtf8(isolate, msg.c_str())));
+  return v8::MaybeLocal<v8::Module>();
+}
+
+// The context group of all inspected contexts: every Inspector inspects all
+// of its isolate's contexts.
+const int kInspectorContextGroupId = 1;
+
+class Inspector;
+
+// InspectorClient is the V8Inspector of an isolate, which all of its
+// Inspectors connect to. It exists while the isolate has any Inspectors, and
+// it inspects every Context of the isolate.
+class InspectorClient : public v8_inspector::V8InspectorClient {
+ public:
+  explicit InspectorClient(v8::Isolate* isolate) : isolate_(isolate), paused_id_(0) {
+    inspector_ = v8_inspector::V8Inspector::create(isolate, this);
+    for (Context* ctx : isolate_data(isolate)->contexts) {
+      ContextCreated(ctx);
+    }
+  }
+
+  void ContextCreated(Context* ctx) {
+    v8::HandleScope handle_scope(isolate_);
+    std::string name = "context " + std::to_string(ctx->id);
+    v8_inspector::StringView view(reinterpret_cast<const uint8_t*>(name.data()), name.length());
+    inspector_->contextCreated(
+        v8_inspector::V8ContextInfo(ctx->ptr.Get(isolate_), kInspectorContextGroupId, view));
+  }
+
+  void ContextDestroyed(Context* ctx) {
+    v8::HandleScope handle_scope(isolate_);
+    inspector_->contextDestroyed(ctx->ptr.Get(isolate_));
+  }
+
+  v8_inspector::V8Inspector* inspector() { return inspector_.get(); }
+
+  // The connected Inspectors.
+  std::vector<Inspector*> sessions;
+
+  // V8InspectorClient
+  void runMessageLoopOnPause(int context_group_id) override;
+  void quitMessageLoopOnPause() override { go_inspector_quit(paused_id_); }
+  void runIfWaitingForDebugger(int context_group_id) override;
+  v8::Local<v8::Context> ensureDefaultContextInGroup(int context_group_id) override {
+    std::vector<Context*>& contexts = isolate_data(isolate_)->contexts;
+    return contexts.empty() ? v8::Local<v8::Context>() : contexts.front()->ptr.Get(isolate_);
+  }
+  double currentTimeMS() override { return platform->CurrentClockTimeMillis(); }
+
+ private:
+  v8::Isolate* isolate_;
+  int paused_id_; // The Inspector that runs the message loop while paused.
+  std::unique_ptr<v8_inspector::V8Inspector> inspector_;
+};
+
+// Inspector connects a V8Inspector session to the Go Inspector with the same
+// id, which exchanges protocol messages with the debugger. Only debuggers,
+// which are pausable, run the message loop while the javascript is paused.
+class Inspector : public v8_inspector::V8Inspector::Channel {
+ public:
+  Inspector(v8::Isolate* isolate, int id, bool pausable)
+      : isolate_(isolate), id_(id), pausable_(pausable) {
+    IsolateData* data = isolate_data(isolate);
+    if (data->inspector_client == nullptr) {
+      data->inspector_client = new InspectorClient(isolate);
+    }
+    client_ = data->inspector_client;
+    client_->sessions.push_back(this);
+    session_ = client_->inspector()->connect(kInspectorContextGroupId, this, v8_inspector::StringView());
+  }
+
+  ~Inspector() {
+    session_.reset();
+    std::vector<Inspector*>& sessions = client_->sessions;
+    sessions.erase(std::find(sessions.begin(), sessions.end(), this));
+    if (sessions.empty()) {
+      isolate_data(isolate_)->inspector_client = nullptr;
+      delete client_;
+    }
+  }
+
+  int id() const { return id_; }
+  bool pausable() const { return pausable_; }
+
+  void Dispatch(const char* msg) {
+    v8::String::Value utf16(v8::String::NewFromUtf8(isolate_, msg));
+    session_->dispatchProtocolMessage(
+        v8_inspector::StringView(reinterpret_cast<const uint16_t*>(*utf16), utf16.length()));
+  }
+
+  void SchedulePause(const char* reason) {
+    v8_inspector::StringView view(reinterpret_cast<const uint8_t*>(reason), strlen(reason));
+    session_->schedulePauseOnNextStatement(view, v8_inspector::StringView());
+  }
+
+  // V8Inspector::Channel
+  void sendResponse(int call_id, std::unique_ptr<v8_inspector::StringBuffer> message) override {
+    Send(message->string());
+  }
+  void sendNotification(std::unique_ptr<v8_inspector::StringBuffer> message) override {
+    Send(message->string());
+  }
+  void flushProtocolNotifications() override {}
+
+ private:
+  void Send(const v8_inspector::StringView& view) {
+    v8::HandleScope handle_scope(isolate_);
+    v8::Local<v8::String> msg = view.is8Bit()
+        ? v8::String::NewFromOneByte(isolate_, view.characters8(),
+                                     v8::NewStringType::kNormal, view.length()).ToLocalChecked()
+        : v8::String::NewFromTwoByte(isolate_, view.characters16(),
+                                     v8::NewStringType::kNormal, view.length()).ToLocalChecked();
+    v8::String::Utf8Value utf8(msg);
+    // Go copies the message, so it doesn't need to be malloc'd.
+    go_inspector_send(id_, String{*utf8, utf8.length()});
+  }
+
+  v8::Isolate* isolate_;
+  int id_;
+  bool pausable_;
+  InspectorClient* client_;
+  std::unique_ptr<v8_inspector::V8InspectorSession> session_;
+};
+
+void InspectorClient::runMessageLoopOnPause(int context_group_id) {
+  // The first debugger dispatches the messages of all sessions while paused.
+  for (Inspector* session : sessions) {
+    if (session->pausable()) {
+      paused_id_ = session->id();
+      go_inspector_pause(paused_id_);
+      return;
+    }
+  }
+}
+
+void InspectorClient::runIfWaitingForDebugger(int context_group_id) {
+  for (Inspector* session : sessions) {
+    if (session->pausable()) {
+      go_inspector_run(session->id());
+    }
+  }
+}
+
+void inspector_dispatch_interrupt(v8::Isolate* isolate, void* data) {
+  go_inspector_dispatch(static_cast<int>(reinterpret_cast<intptr_t>(data)));
+}
+
+GCType gc_type(v8::GCType type) {
+  switch (type) {
+    case v8::kGCTypeScavenge: return kGCScavenge;
+    case v8::kGCTypeMinorMarkCompact: return kGCMinorMarkCompact;
+    case v8::kGCTypeMarkSweepCompact: return kGCMarkSweepCompact;
+    case v8::kGCTypeIncrementalMarking: return kGCIncrementalMarking;
+    default: return kGCProcessWeakCallbacks;
+  }
+}
+
+size_t used_heap_size(v8::Isolate* isolate) {
+  v8::HeapStatistics hs;
+  isolate->GetHeapStatistics(&hs);
+  return hs.used_heap_size();
+}
+
+void gc_prologue(v8::Isolate* isolate, v8::GCType type, v8::GCCallbackFlags flags) {
+  IsolateData* data = isolate_data(isolate);
+  GCType t = gc_type(type);
+  data->gc_start[t] = platform->MonotonicallyIncreasingTime();
+  data->gc_used_heap_size[t] = used_heap_size(isolate);
+}
+
+void gc_epilogue(v8::Isolate* isolate, v8::GCType type, v8::GCCallbackFlags flags) {
+  IsolateData* data = isolate_data(isolate);
+  GCType t = gc_type(type);
+  go_gc_handler(data->gc_callbacks_id, GCEvent{
+    t,
+    (flags & (v8::kGCCallbackFlagForced | v8::kGCCallbackFlagCollectAllAvailableGarbage)) != 0,
+    platform->MonotonicallyIncreasingTime() - data->gc_start[t],
+    data->gc_used_heap_size[t],
+    used_heap_size(isolate),
+  });
+}
+
+// HeapSnapshotStream passes the chunks of a serialized heap snapshot to
+// go_heap_snapshot_write as they're produced, so that the JSON is never
+// buffered as a whole.
+class HeapSnapshotStream : public v8::OutputStream {
+ public:
+  explicit HeapSnapshotStream(int id) : id_(id) {}
+
+  int GetChunkSize() override { return 64 * 1024; }
+  void EndOfStream() override {}
+  WriteResult WriteAsciiChunk(char* data, int size) override {
+    return go_heap_snapshot_write(id_, data, size) ? kContinue : kAbort;
+  }
+
+ private:
+  int id_;
+};
 
 extern "C" {
 
 Version version = {V8_MAJOR_VERSION, V8_MINOR_VERSION, V8_BUILD_NUMBER, V8_PATCH_LEVEL};
 
 void v8_init() {
-  v8::Platform *platform = v8::platform::CreateDefaultPlatform(
+  platform = v8::platform::CreateDefaultPlatform(
       0, // thread_pool_size
       v8::platform::IdleTaskSupport::kDisabled,
       v8::platform::InProcessStackDumping::kDisabled);
@@ -182,18 +585,189 @@ StartupData v8_CreateSnapshotDataBlob(const char* js) {
   return StartupData{data.data, data.raw_size};
 }
 
-IsolatePtr v8_Isolate_New(StartupData startup_data) {
+void go_callback(const v8::FunctionCallbackInfo<v8::Value>& args);
+
+// The native functions that snapshots may refer to. Every isolate must be
+// created with the same list that was used to create its snapshot.
+intptr_t external_references[] = {
+  reinterpret_cast<intptr_t>(go_callback),
+  0,
+};
+
+// run_snapshot_code runs the code in the context of a snapshot that is being
+// created. If it throws, it returns false and sets the error of res.
+bool run_snapshot_code(v8::Isolate* isolate, v8::Local<v8::Context> ctx,
+                       const char* js, const char* filename, SnapshotTuple* res) {
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::ScriptOrigin origin(v8::String::NewFromUtf8(isolate, filename));
+  v8::Local<v8::Script> script;
+  if (!v8::Script::Compile(ctx, v8::String::NewFromUtf8(isolate, js), &origin).ToLocal(&script) ||
+      script->Run(ctx).IsEmpty()) {
+    res->error_msg = DupString(report_exception(isolate, ctx, try_catch));
+    res->exception = detached_exception(isolate, ctx, try_catch);
+    return false;
+  }
+  return true;
+}
+
+// new_snapshot_context creates a new context for a snapshot that is being
+// created, with the snapshot's Go callbacks as global functions.
+v8::Local<v8::Context> new_snapshot_context(v8::Isolate* isolate,
+                                            const char** callback_names, int num_callbacks) {
+  v8::EscapableHandleScope handle_scope(isolate);
+  v8::Local<v8::Context> ctx = v8::Context::New(isolate);
+  // There's no Go context while creating the snapshot, so go_callback
+  // rejects any calls.
+  ctx->SetAlignedPointerInEmbedderData(kContextEmbedderDataIndex, nullptr);
+
+  for (int i = 0; i < num_callbacks; i++) {
+    std::string id = std::string("@") + callback_names[i];
+    v8::Local<v8::String> name = v8::String::NewFromUtf8(isolate, callback_names[i]);
+    v8::Local<v8::FunctionTemplate> cb = v8::FunctionTemplate::New(
+        isolate, go_callback, v8::String::NewFromUtf8(isolate, id.c_str()));
+    cb->SetClassName(name);
+    ctx->Global()->Set(ctx, name, cb->GetFunction(ctx).ToLocalChecked()).FromJust();
+  }
+  return handle_scope.Escape(ctx);
+}
+
+// snapshot_context returns a new context from the snapshot that the isolate
+// was created with: index 0 is the default context, all others were added.
+v8::MaybeLocal<v8::Context> snapshot_context(v8::Isolate* isolate, int index) {
+  if (index == 0) {
+    return v8::Context::New(isolate);
+  }
+  return v8::Context::FromSnapshot(isolate, index - 1);
+}
+
+SnapshotTuple v8_CreateSnapshot(SnapshotContext* contexts, int num_contexts,
+                                const char** callback_names, int num_callbacks,
+                                int keep_function_code) {
+  SnapshotTuple res = {{nullptr, 0}, {nullptr, 0}, nullptr};
+
+  bool warm_up = false;
+  for (int i = 0; i < num_contexts; i++) {
+    warm_up = warm_up || contexts[i].warm_up != nullptr;
+  }
+
+  v8::StartupData cold;
+  {
+    v8::SnapshotCreator creator(external_references);
+    v8::Isolate* isolate = creator.GetIsolate();
+    isolate->SetCaptureStackTraceForUncaughtExceptions(true);
+    {
+      v8::HandleScope handle_scope(isolate);
+      for (int i = 0; i < num_contexts; i++) {
+        v8::Local<v8::Context> ctx = new_snapshot_context(isolate, callback_names, num_callbacks);
+        v8::Context::Scope context_scope(ctx);
+        if (!run_snapshot_code(isolate, ctx, contexts[i].js, contexts[i].filename, &res)) {
+          return res;
+        }
+        if (i == 0) {
+          creator.SetDefaultContext(ctx);
+        } else {
+          creator.AddContext(ctx);
+        }
+      }
+    }
+    cold = creator.CreateBlob(keep_function_code && !warm_up
+        ? v8::SnapshotCreator::FunctionCodeHandling::kKeep
+        : v8::SnapshotCreator::FunctionCodeHandling::kClear);
+  }
+  if (!warm_up) {
+    res.data = StartupData{cold.data, cold.raw_size};
+    return res;
+  }
+
+  // Just like V8's WarmUpSnapshotDataBlob: run the warm-up code in throwaway
+  // contexts so that the functions are compiled, then snapshot fresh contexts
+  // and keep the compiled code.
+  {
+    v8::SnapshotCreator creator(external_references, &cold);
+    v8::Isolate* isolate = creator.GetIsolate();
+    isolate->SetCaptureStackTraceForUncaughtExceptions(true);
+    for (int i = 0; i < num_contexts; i++) {
+      if (contexts[i].warm_up == nullptr) {
+        continue;
+      }
+      v8::HandleScope handle_scope(isolate);
+      v8::Local<v8::Context> ctx = snapshot_context(isolate, i).ToLocalChecked();
+      v8::Context::Scope context_scope(ctx);
+      if (!run_snapshot_code(isolate, ctx, contexts[i].warm_up, contexts[i].warm_up_filename,
+                             &res)) {
+        delete[] cold.data;
+        return res;
+      }
+    }
+    {
+      v8::HandleScope handle_scope(isolate);
+      isolate->ContextDisposedNotification(false);
+      for (int i = 0; i < num_contexts; i++) {
+        v8::Local<v8::Context> ctx = snapshot_context(isolate, i).ToLocalChecked();
+        if (i == 0) {
+          creator.SetDefaultContext(ctx);
+        } else {
+          creator.AddContext(ctx);
+        }
+      }
+    }
+    v8::StartupData data = creator.CreateBlob(v8::SnapshotCreator::FunctionCodeHandling::kKeep);
+    res.data = StartupData{data.data, data.raw_size};
+  }
+  delete[] cold.data;
+  return res;
+}
+
+IsolatePtr v8_Isolate_New(StartupData startup_data, IsolateOptions opts) {
   v8::Isolate::CreateParams create_params;
   create_params.array_buffer_allocator = allocator;
+  create_params.external_references = external_references;
   if (startup_data.len > 0 && startup_data.ptr != nullptr) {
     v8::StartupData* data = new v8::StartupData;
     data->data = startup_data.ptr;
     data->raw_size = startup_data.len;
     create_params.snapshot_blob = data;
   }
-  return static_cast<IsolatePtr>(v8::Isolate::New(create_params));
+
+  const size_t MB = 1024 * 1024;
+  if (opts.MaxHeapBytes > 0) {
+    create_params.constraints.set_max_old_space_size(int((opts.MaxHeapBytes + MB - 1) / MB));
+  }
+  if (opts.MaxYoungGenBytes > 0) {
+    // The young generation consists of two semi-spaces.
+    size_t semi_space = opts.MaxYoungGenBytes / 2;
+#if V8_MAJOR_VERSION > 6 || (V8_MAJOR_VERSION == 6 && V8_MINOR_VERSION >= 4)
+    create_params.constraints.set_max_semi_space_size_in_kb(semi_space < 1024 ? 1 : semi_space / 1024);
+#else
+    create_params.constraints.set_max_semi_space_size(semi_space < MB ? 1 : semi_space / MB);
+#endif
+  }
+
+  v8::Isolate* isolate = v8::Isolate::New(create_params);
+  IsolateData* data = new IsolateData();
+  data->stack_limit = opts.StackLimit;
+  isolate->SetData(0, data);
+#ifdef HAS_NEAR_HEAP_LIMIT_CALLBACK
+  isolate->AddNearHeapLimitCallback(near_heap_limit, isolate);
+#endif
+  return static_cast<IsolatePtr>(isolate);
+}
+ContextPtr new_context(v8::Isolate* isolate, v8::Local<v8::Context> local_ctx, int id) {
+  Context* ctx = new Context;
+  local_ctx->SetAlignedPointerInEmbedderData(kContextEmbedderDataIndex, ctx);
+  ctx->ptr.Reset(isolate, local_ctx);
+  ctx->isolate = isolate;
+  ctx->id = id;
+  IsolateData* data = isolate_data(isolate);
+  data->contexts.push_back(ctx);
+  if (data->inspector_client != nullptr) {
+    data->inspector_client->ContextCreated(ctx);
+  }
+  return static_cast<ContextPtr>(ctx);
 }
-ContextPtr v8_Isolate_NewContext(IsolatePtr isolate_ptr) {
+ContextPtr v8_Isolate_NewContext(IsolatePtr isolate_ptr, int id) {
   ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
   v8::HandleScope handle_scope(isolate);
 
@@ -201,21 +775,87 @@ ContextPtr v8_Isolate_NewContext(IsolatePtr isolate_ptr) {
 
   v8::Local<v8::ObjectTemplate> globals = v8::ObjectTemplate::New(isolate);
 
-  Context* ctx = new Context;
-  ctx->ptr.Reset(isolate, v8::Context::New(isolate, nullptr, globals));
-  ctx->isolate = isolate;
-  return static_cast<ContextPtr>(ctx);
+  return new_context(isolate, v8::Context::New(isolate, nullptr, globals), id);
+}
+ContextPtr v8_Isolate_NewContextFromSnapshot(IsolatePtr isolate_ptr, int index, int id) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+
+  isolate->SetCaptureStackTraceForUncaughtExceptions(true);
+
+  v8::Local<v8::Context> local_ctx;
+  if (!snapshot_context(isolate, index).ToLocal(&local_ctx)) {
+    return nullptr;
+  }
+  return new_context(isolate, local_ctx, id);
 }
 void v8_Isolate_Terminate(IsolatePtr isolate_ptr) {
   v8::Isolate* isolate = static_cast<v8::Isolate*>(isolate_ptr);
   isolate->TerminateExecution();
 }
+LockerPtr v8_Isolate_Lock(IsolatePtr isolate_ptr) {
+  // Lockers are reentrant, so every call into the isolate on this thread
+  // succeeds while other threads wait.
+  return static_cast<LockerPtr>(new v8::Locker(static_cast<v8::Isolate*>(isolate_ptr)));
+}
+void v8_Isolate_Unlock(LockerPtr locker_ptr) {
+  delete static_cast<v8::Locker*>(locker_ptr);
+}
+void interrupt_callback(v8::Isolate* isolate, void* data) {
+  v8::HandleScope handle_scope(isolate);
+  Context* c = nullptr;
+  v8::Local<v8::Context> ctx = isolate->GetCurrentContext();
+  if (!ctx.IsEmpty()) {
+    c = static_cast<Context*>(
+        ctx->GetAlignedPointerFromEmbedderData(kContextEmbedderDataIndex));
+  }
+  go_interrupt_handler(static_cast<int>(reinterpret_cast<intptr_t>(data)),
+                       c != nullptr ? c->id : 0, c);
+}
+void v8_Isolate_RequestInterrupt(IsolatePtr isolate_ptr, int id) {
+  v8::Isolate* isolate = static_cast<v8::Isolate*>(isolate_ptr);
+  isolate->RequestInterrupt(interrupt_callback, reinterpret_cast<void*>(static_cast<intptr_t>(id)));
+}
+void v8_Isolate_CancelTerminate(IsolatePtr isolate_ptr) {
+  v8::Isolate* isolate = static_cast<v8::Isolate*>(isolate_ptr);
+  isolate->CancelTerminateExecution();
+}
+void v8_Isolate_RunMicrotasks(IsolatePtr isolate_ptr) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  isolate->RunMicrotasks();
+}
+int v8_Isolate_TakeHeapLimitExceeded(IsolatePtr isolate_ptr) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  IsolateData* data = isolate_data(isolate);
+  if (!data->heap_limit_exceeded) {
+    return 0;
+  }
+  data->heap_limit_exceeded = false;
+  isolate->CancelTerminateExecution();
+#ifdef HAS_NEAR_HEAP_LIMIT_CALLBACK
+  // Restore the initial heap limit that was raised by near_heap_limit.
+  isolate->RemoveNearHeapLimitCallback(near_heap_limit, data->initial_heap_limit);
+  isolate->AddNearHeapLimitCallback(near_heap_limit, isolate);
+#endif
+  return 1;
+}
 void v8_Isolate_Release(IsolatePtr isolate_ptr) {
   if (isolate_ptr == nullptr) {
     return;
   }
   v8::Isolate* isolate = static_cast<v8::Isolate*>(isolate_ptr);
+  IsolateData* data = isolate_data(isolate);
+  {
+    // Wait for any thread that is still using the isolate. The Locker must be
+    // gone before Dispose, since unlocking uses the isolate.
+    v8::Locker locker(isolate);
+    if (data->cpu_profiler != nullptr) {
+      data->cpu_profiler->Dispose();
+    }
+  }
   isolate->Dispose();
+  delete data;
 }
 
 ValueTuple v8_Context_Run(ContextPtr ctxptr, const char* code, const char* filename) {
@@ -223,6 +863,7 @@ ValueTuple v8_Context_Run(ContextPtr ctxptr, const char* code, const char* filen
   v8::Isolate* isolate = ctx->isolate;
   v8::Locker locker(isolate);
   v8::Isolate::Scope isolate_scope(isolate);
+  StackLimitScope stack_limit_scope(isolate);
   v8::HandleScope handle_scope(isolate);
   v8::Context::Scope context_scope(ctx->ptr.Get(isolate));
   v8::TryCatch try_catch(isolate);
@@ -237,14 +878,13 @@ ValueTuple v8_Context_Run(ContextPtr ctxptr, const char* code, const char* filen
       v8::String::NewFromUtf8(isolate, filename));
 
   if (script.IsEmpty()) {
-    res.error_msg = DupString(report_exception(isolate, ctx->ptr.Get(isolate), try_catch));
-    return res;
+    return exception_tuple(isolate, ctx->ptr.Get(isolate), try_catch);
   }
 
   v8::Local<v8::Value> result = script->Run();
 
   if (result.IsEmpty()) {
-    res.error_msg = DupString(report_exception(isolate, ctx->ptr.Get(isolate), try_catch));
+    return exception_tuple(isolate, ctx->ptr.Get(isolate), try_catch);
   } else {
     res.Value = static_cast<PersistentValuePtr>(new Value(isolate, result));
     res.Kinds = v8_Value_KindsFromLocal(result);
@@ -253,8 +893,6 @@ ValueTuple v8_Context_Run(ContextPtr ctxptr, const char* code, const char* filen
 	return res;
 }
 
-void go_callback(const v8::FunctionCallbackInfo<v8::Value>& args);
-
 PersistentValuePtr v8_Context_RegisterCallback(
     ContextPtr ctxptr,
     const char* name,
@@ -274,6 +912,18 @@ void go_callback(const v8::FunctionCallbackInfo<v8::Value>& args) {
   v8::HandleScope scope(iso);
 
   std::string id = str(args.Data());
+  if (!id.empty() && id[0] == '@') {
+    // A callback from a snapshot, which is identified by name rather than
+    // by context.
+    Context* ctx = static_cast<Context*>(
+        iso->GetCurrentContext()->GetAlignedPointerFromEmbedderData(kContextEmbedderDataIndex));
+    if (ctx == nullptr) {
+      std::string msg = "Cannot call Go callback " + id.substr(1) + " while creating a snapshot";
+      iso->ThrowException(v8::Exception::Error(v8::String::NewFromUtf8(iso, msg.c_str())));
+      return;
+    }
+    id = std::to_string(ctx->id) + ":" + id;
+  }
 
   std::string src_file, src_func;
   int line_number = 0, column = 0;
@@ -325,6 +975,16 @@ void v8_Context_Release(ContextPtr ctxptr) {
   }
   Context* ctx = static_cast<Context*>(ctxptr);
   ISOLATE_SCOPE(ctx->isolate);
+  IsolateData* data = isolate_data(isolate);
+  data->contexts.erase(std::find(data->contexts.begin(), data->contexts.end(), ctx));
+  if (data->inspector_client != nullptr) {
+    data->inspector_client->ContextDestroyed(ctx);
+  }
+  for (Module* module : ctx->modules) {
+    module->ptr.Reset();
+    delete module;
+  }
+  ctx->modules.clear();
   ctx->ptr.Reset();
 }
 
@@ -360,6 +1020,9 @@ PersistentValuePtr v8_Context_Create(ContextPtr ctxptr, ImmediateValue val) {
 ValueTuple v8_Value_Get(ContextPtr ctxptr, PersistentValuePtr valueptr, const char* field) {
   VALUE_SCOPE(ctxptr);
 
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
   Value* value = static_cast<Value*>(valueptr);
   v8::Local<v8::Value> maybeObject = value->Get(isolate);
   if (!maybeObject->IsObject()) {
@@ -370,7 +1033,10 @@ ValueTuple v8_Value_Get(ContextPtr ctxptr, PersistentValuePtr valueptr, const ch
   // we've just created the local object above.
   v8::Local<v8::Object> object = maybeObject->ToObject(ctx).ToLocalChecked();
 
-  v8::Local<v8::Value> localValue = object->Get(ctx, v8::String::NewFromUtf8(isolate, field)).ToLocalChecked();
+  v8::Local<v8::Value> localValue;
+  if (!object->Get(ctx, v8::String::NewFromUtf8(isolate, field)).ToLocal(&localValue)) {
+    return exception_tuple(isolate, ctx, try_catch);
+  }
 
   return (ValueTuple){
     new Value(isolate, localValue),
@@ -382,6 +1048,9 @@ ValueTuple v8_Value_Get(ContextPtr ctxptr, PersistentValuePtr valueptr, const ch
 ValueTuple v8_Value_GetIdx(ContextPtr ctxptr, PersistentValuePtr valueptr, int idx) {
   VALUE_SCOPE(ctxptr);
 
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
   Value* value = static_cast<Value*>(valueptr);
   v8::Local<v8::Value> maybeObject = value->Get(isolate);
   if (!maybeObject->IsObject()) {
@@ -400,19 +1069,24 @@ ValueTuple v8_Value_GetIdx(ContextPtr ctxptr, PersistentValuePtr valueptr, int i
     // We can safely call `ToLocalChecked`, because
     // we've just created the local object above.
     v8::Local<v8::Object> object = maybeObject->ToObject(ctx).ToLocalChecked();
-    obj = object->Get(ctx, uint32_t(idx)).ToLocalChecked();
+    if (!object->Get(ctx, uint32_t(idx)).ToLocal(&obj)) {
+      return exception_tuple(isolate, ctx, try_catch);
+    }
   }
   return (ValueTuple){new Value(isolate, obj), v8_Value_KindsFromLocal(obj), nullptr};
 }
 
-Error v8_Value_Set(ContextPtr ctxptr, PersistentValuePtr valueptr,
-                   const char* field, PersistentValuePtr new_valueptr) {
+ValueTuple v8_Value_Set(ContextPtr ctxptr, PersistentValuePtr valueptr,
+                        const char* field, PersistentValuePtr new_valueptr) {
   VALUE_SCOPE(ctxptr);
 
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
   Value* value = static_cast<Value*>(valueptr);
   v8::Local<v8::Value> maybeObject = value->Get(isolate);
   if (!maybeObject->IsObject()) {
-    return DupString("Not an object");
+    return (ValueTuple){nullptr, 0, DupString("Not an object")};
   }
 
   // We can safely call `ToLocalChecked`, because
@@ -426,21 +1100,24 @@ Error v8_Value_Set(ContextPtr ctxptr, PersistentValuePtr valueptr,
     object->Set(ctx, v8::String::NewFromUtf8(isolate, field), new_value_local);
 
   if (res.IsNothing()) {
-    return DupString("Something went wrong -- set returned nothing.");
+    return exception_tuple(isolate, ctx, try_catch);
   } else if (!res.FromJust()) {
-    return DupString("Something went wrong -- set failed.");
+    return (ValueTuple){nullptr, 0, DupString("Something went wrong -- set failed.")};
   }
-  return (Error){nullptr, 0};
+  return (ValueTuple){nullptr, 0, nullptr};
 }
 
-Error v8_Value_SetIdx(ContextPtr ctxptr, PersistentValuePtr valueptr,
-                      int idx, PersistentValuePtr new_valueptr) {
+ValueTuple v8_Value_SetIdx(ContextPtr ctxptr, PersistentValuePtr valueptr,
+                           int idx, PersistentValuePtr new_valueptr) {
   VALUE_SCOPE(ctxptr);
 
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
   Value* value = static_cast<Value*>(valueptr);
   v8::Local<v8::Value> maybeObject = value->Get(isolate);
   if (!maybeObject->IsObject()) {
-    return DupString("Not an object");
+    return (ValueTuple){nullptr, 0, DupString("Not an object")};
   }
 
   Value* new_value = static_cast<Value*>(new_valueptr);
@@ -448,9 +1125,9 @@ Error v8_Value_SetIdx(ContextPtr ctxptr, PersistentValuePtr valueptr,
   if (maybeObject->IsArrayBuffer()) {
     v8::ArrayBuffer* bufPtr = v8::ArrayBuffer::Cast(*maybeObject);
     if (!new_value_local->IsNumber()) {
-      return DupString("Cannot assign non-number into array buffer");
+      return (ValueTuple){nullptr, 0, DupString("Cannot assign non-number into array buffer")};
     } else if (idx >= bufPtr->GetContents().ByteLength()) {
-      return DupString("Cannot assign to an index beyond the size of an array buffer");
+      return (ValueTuple){nullptr, 0, DupString("Cannot assign to an index beyond the size of an array buffer")};
     } else {
       ((unsigned char*)bufPtr->GetContents().Data())[idx] = new_value_local->ToNumber(ctx).ToLocalChecked()->Value();
     }
@@ -462,13 +1139,13 @@ Error v8_Value_SetIdx(ContextPtr ctxptr, PersistentValuePtr valueptr,
     v8::Maybe<bool> res = object->Set(ctx, uint32_t(idx), new_value_local);
 
     if (res.IsNothing()) {
-      return DupString("Something went wrong -- set returned nothing.");
+      return exception_tuple(isolate, ctx, try_catch);
     } else if (!res.FromJust()) {
-      return DupString("Something went wrong -- set failed.");
+      return (ValueTuple){nullptr, 0, DupString("Something went wrong -- set failed.")};
     }
   }
 
-  return (Error){nullptr, 0};
+  return (ValueTuple){nullptr, 0, nullptr};
 }
 
 ValueTuple v8_Value_Call(ContextPtr ctxptr,
@@ -503,7 +1180,7 @@ ValueTuple v8_Value_Call(ContextPtr ctxptr,
   delete[] argv;
 
   if (result.IsEmpty()) {
-    return (ValueTuple){nullptr, 0, DupString(report_exception(isolate, ctx, try_catch))};
+    return exception_tuple(isolate, ctx, try_catch);
   }
 
   v8::Local<v8::Value> value = result.ToLocalChecked();
@@ -538,7 +1215,7 @@ ValueTuple v8_Value_New(ContextPtr ctxptr,
   delete[] argv;
 
   if (result.IsEmpty()) {
-    return (ValueTuple){nullptr, 0, DupString(report_exception(isolate, ctx, try_catch))};
+    return exception_tuple(isolate, ctx, try_catch);
   }
 
   v8::Local<v8::Value> value = result.ToLocalChecked();
@@ -602,25 +1279,91 @@ ByteArray v8_Value_Bytes(ContextPtr ctxptr, PersistentValuePtr valueptr) {
   v8::Local<v8::Value> value = static_cast<Value*>(valueptr)->Get(isolate);
 
   v8::ArrayBuffer* bufPtr;
+  size_t offset = 0, length = 0;
 
-  if (value->IsTypedArray()) {
-    bufPtr = *v8::TypedArray::Cast(*value)->Buffer();
+  if (value->IsArrayBufferView()) {
+    v8::ArrayBufferView* view = v8::ArrayBufferView::Cast(*value);
+    bufPtr = *view->Buffer();
+    offset = view->ByteOffset();
+    length = view->ByteLength();
   } else if (value->IsArrayBuffer()) {
     bufPtr = v8::ArrayBuffer::Cast(*value);
+    length = bufPtr->GetContents().ByteLength();
   } else {
     return (ByteArray){ nullptr, 0 };
   }
 
-  if (bufPtr == NULL) {
+  if (bufPtr == NULL || bufPtr->GetContents().Data() == NULL) {
     return (ByteArray){ nullptr, 0 };
   }
 
   return (ByteArray){
-    static_cast<const char*>(bufPtr->GetContents().Data()),
-    static_cast<int>(bufPtr->GetContents().ByteLength()),
+    static_cast<const char*>(bufPtr->GetContents().Data()) + offset,
+    static_cast<int>(length),
   };
 }
 
+ValueTuple v8_Value_Keys(ContextPtr ctxptr, PersistentValuePtr valueptr) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::Local<v8::Value> maybeObject = static_cast<Value*>(valueptr)->Get(isolate);
+  if (!maybeObject->IsObject()) {
+    return (ValueTuple){nullptr, 0, DupString("Not an object")};
+  }
+
+  // We can safely call `ToLocalChecked`, because
+  // we've just created the local object above.
+  v8::Local<v8::Object> object = maybeObject->ToObject(ctx).ToLocalChecked();
+
+  // Only the object's own, enumerable, string-keyed properties are returned,
+  // matching what Object.keys() and JSON.stringify() would see.
+  v8::MaybeLocal<v8::Array> keys = object->GetOwnPropertyNames(ctx);
+  if (keys.IsEmpty()) {
+    return exception_tuple(isolate, ctx, try_catch);
+  }
+
+  v8::Local<v8::Value> result = keys.ToLocalChecked();
+  return (ValueTuple){
+    new Value(isolate, result),
+    v8_Value_KindsFromLocal(result),
+    nullptr,
+  };
+}
+
+ValueTuple v8_Value_AsArray(ContextPtr ctxptr, PersistentValuePtr valueptr) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::Local<v8::Value> value = static_cast<Value*>(valueptr)->Get(isolate);
+
+  // Maps are flattened into [key0, value0, key1, value1, ...] while sets are
+  // simply a list of their members.
+  v8::Local<v8::Array> result;
+  if (value->IsMap()) {
+    result = v8::Map::Cast(*value)->AsArray();
+  } else if (value->IsSet()) {
+    result = v8::Set::Cast(*value)->AsArray();
+  } else {
+    return (ValueTuple){nullptr, 0, DupString("Not a map or set")};
+  }
+
+  return (ValueTuple){
+    new Value(isolate, result),
+    v8_Value_KindsFromLocal(result),
+    nullptr,
+  };
+}
+
+int v8_Value_StrictEquals(ContextPtr ctxptr, PersistentValuePtr aptr,
+                          PersistentValuePtr bptr) {
+  VALUE_SCOPE(ctxptr);
+  v8::Local<v8::Value> a = static_cast<Value*>(aptr)->Get(isolate);
+  v8::Local<v8::Value> b = static_cast<Value*>(bptr)->Get(isolate);
+  return a->StrictEquals(b) ? 1 : 0;
+}
+
 HeapStatistics v8_Isolate_GetHeapStatistics(IsolatePtr isolate_ptr) {
   if (isolate_ptr == nullptr) {
     return HeapStatistics{0};
@@ -641,6 +1384,147 @@ HeapStatistics v8_Isolate_GetHeapStatistics(IsolatePtr isolate_ptr) {
   };
 }
 
+HeapSpaceStatisticsList v8_Isolate_GetHeapSpaceStatistics(IsolatePtr isolate_ptr) {
+  if (isolate_ptr == nullptr) {
+    return HeapSpaceStatisticsList{nullptr, 0};
+  }
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  size_t n = isolate->NumberOfHeapSpaces();
+  HeapSpaceStatisticsList res{
+    static_cast<HeapSpaceStatistics*>(malloc(n * sizeof(HeapSpaceStatistics))),
+    0,
+  };
+  for (size_t i = 0; i < n; i++) {
+    v8::HeapSpaceStatistics ss;
+    if (!isolate->GetHeapSpaceStatistics(&ss, i)) {
+      continue;
+    }
+    res.spaces[res.num_spaces++] = HeapSpaceStatistics{
+      DupString(ss.space_name()),
+      ss.space_size(),
+      ss.space_used_size(),
+      ss.space_available_size(),
+      ss.physical_space_size(),
+    };
+  }
+  return res;
+}
+
+HeapCodeStatistics v8_Isolate_GetHeapCodeStatistics(IsolatePtr isolate_ptr) {
+  if (isolate_ptr == nullptr) {
+    return HeapCodeStatistics{0};
+  }
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HeapCodeStatistics cs;
+  isolate->GetHeapCodeAndMetadataStatistics(&cs);
+  return HeapCodeStatistics{
+    cs.code_and_metadata_size(),
+    cs.bytecode_and_metadata_size(),
+  };
+}
+
+void v8_Isolate_AddGCCallbacks(IsolatePtr isolate_ptr, int id) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  isolate_data(isolate)->gc_callbacks_id = id;
+  isolate->AddGCPrologueCallback(gc_prologue);
+  isolate->AddGCEpilogueCallback(gc_epilogue);
+}
+
+CPUProfileStart v8_Isolate_StartCPUProfile(IsolatePtr isolate_ptr, const char* name) {
+  // V8 samples the thread that starts the first of the profiles being
+  // recorded, which is only the one running the javascript while it holds the
+  // lock, i.e. before ISOLATE_SCOPE takes it.
+  if (!v8::Locker::IsLocked(static_cast<v8::Isolate*>(isolate_ptr))) {
+    return kCPUProfileNotLocked;
+  }
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  IsolateData* data = isolate_data(isolate);
+  if (data->cpu_profiles.empty()) {
+    data->cpu_profile_thread = std::this_thread::get_id();
+  } else if (data->cpu_profile_thread != std::this_thread::get_id()) {
+    return kCPUProfileOtherThread;
+  }
+  if (data->cpu_profiler == nullptr) {
+    data->cpu_profiler = v8::CpuProfiler::New(isolate);
+  }
+  if (std::find(data->cpu_profiles.begin(), data->cpu_profiles.end(), name) ==
+      data->cpu_profiles.end()) {
+    data->cpu_profiles.push_back(name);
+  }
+  data->cpu_profiler->StartProfiling(v8::String::NewFromUtf8(isolate, name), true);
+  return kCPUProfileStarted;
+}
+
+void flatten_cpu_profile_node(const v8::CpuProfileNode* node, int parent,
+                              std::vector<CPUProfileNode>* nodes) {
+  int index = nodes->size();
+  nodes->push_back(CPUProfileNode{
+    int(node->GetNodeId()),
+    parent,
+    DupString(node->GetFunctionName()),
+    DupString(node->GetScriptResourceName()),
+    node->GetScriptId(),
+    node->GetLineNumber(),
+    node->GetColumnNumber(),
+    node->GetHitCount(),
+    DupString(node->GetBailoutReason()),
+  });
+  for (int i = 0; i < node->GetChildrenCount(); i++) {
+    flatten_cpu_profile_node(node->GetChild(i), index, nodes);
+  }
+}
+
+CPUProfile* v8_Isolate_StopCPUProfile(IsolatePtr isolate_ptr, const char* name) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  IsolateData* data = isolate_data(isolate);
+  if (data->cpu_profiler == nullptr) {
+    return nullptr;
+  }
+  v8::CpuProfile* profile = data->cpu_profiler->StopProfiling(v8::String::NewFromUtf8(isolate, name));
+  if (profile == nullptr) {
+    return nullptr;
+  }
+  auto it = std::find(data->cpu_profiles.begin(), data->cpu_profiles.end(), name);
+  if (it != data->cpu_profiles.end()) {
+    data->cpu_profiles.erase(it);
+  }
+
+  std::vector<CPUProfileNode> nodes;
+  flatten_cpu_profile_node(profile->GetTopDownRoot(), -1, &nodes);
+
+  CPUProfile* res = static_cast<CPUProfile*>(calloc(1, sizeof(CPUProfile)));
+  res->NumNodes = nodes.size();
+  res->Nodes = static_cast<CPUProfileNode*>(malloc(nodes.size() * sizeof(CPUProfileNode)));
+  memcpy(res->Nodes, nodes.data(), nodes.size() * sizeof(CPUProfileNode));
+
+  res->NumSamples = profile->GetSamplesCount();
+  if (res->NumSamples > 0) {
+    res->Samples = static_cast<int*>(malloc(res->NumSamples * sizeof(int)));
+    res->Timestamps = static_cast<int64_t*>(malloc(res->NumSamples * sizeof(int64_t)));
+    for (int i = 0; i < res->NumSamples; i++) {
+      res->Samples[i] = profile->GetSample(i)->GetNodeId();
+      res->Timestamps[i] = profile->GetSampleTimestamp(i);
+    }
+  }
+  res->StartTime = profile->GetStartTime();
+  res->EndTime = profile->GetEndTime();
+
+  profile->Delete();
+  return res;
+}
+
+void v8_Isolate_WriteHeapSnapshot(IsolatePtr isolate_ptr, int id) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  v8::HeapProfiler* profiler = isolate->GetHeapProfiler();
+  const v8::HeapSnapshot* snapshot = profiler->TakeHeapSnapshot();
+  HeapSnapshotStream stream(id);
+  snapshot->Serialize(&stream, v8::HeapSnapshot::kJSON);
+  const_cast<v8::HeapSnapshot*>(snapshot)->Delete();
+}
+
 void v8_Isolate_LowMemoryNotification(IsolatePtr isolate_ptr) {
   if (isolate_ptr == nullptr) {
     return;
@@ -666,4 +1550,263 @@ ValueTuple v8_Value_PromiseInfo(ContextPtr ctxptr, PersistentValuePtr valueptr,
   return (ValueTuple){new Value(isolate, res), v8_Value_KindsFromLocal(res), nullptr};
 }
 
+ValueTuple v8_Context_NewResolver(ContextPtr ctxptr) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::Local<v8::Promise::Resolver> resolver;
+  if (!v8::Promise::Resolver::New(ctx).ToLocal(&resolver)) {
+    return exception_tuple(isolate, ctx, try_catch);
+  }
+  return (ValueTuple){new Value(isolate, resolver), v8_Value_KindsFromLocal(resolver), nullptr};
+}
+
+ValueTuple v8_Resolver_GetPromise(ContextPtr ctxptr, PersistentValuePtr resolverptr) {
+  VALUE_SCOPE(ctxptr);
+  v8::Local<v8::Promise::Resolver> resolver = v8::Local<v8::Promise::Resolver>::Cast(
+      static_cast<Value*>(resolverptr)->Get(isolate));
+  v8::Local<v8::Promise> promise = resolver->GetPromise();
+  return (ValueTuple){new Value(isolate, promise), v8_Value_KindsFromLocal(promise), nullptr};
+}
+
+ValueTuple v8_Resolver_Resolve(ContextPtr ctxptr, PersistentValuePtr resolverptr,
+                               PersistentValuePtr valueptr) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::Local<v8::Promise::Resolver> resolver = v8::Local<v8::Promise::Resolver>::Cast(
+      static_cast<Value*>(resolverptr)->Get(isolate));
+  v8::Local<v8::Value> value = static_cast<Value*>(valueptr)->Get(isolate);
+  if (resolver->Resolve(ctx, value).IsNothing()) {
+    return exception_tuple(isolate, ctx, try_catch);
+  }
+  return (ValueTuple){nullptr, 0, nullptr};
+}
+
+ValueTuple v8_Resolver_Reject(ContextPtr ctxptr, PersistentValuePtr resolverptr,
+                              PersistentValuePtr valueptr) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::Local<v8::Promise::Resolver> resolver = v8::Local<v8::Promise::Resolver>::Cast(
+      static_cast<Value*>(resolverptr)->Get(isolate));
+  v8::Local<v8::Value> value = static_cast<Value*>(valueptr)->Get(isolate);
+  if (resolver->Reject(ctx, value).IsNothing()) {
+    return exception_tuple(isolate, ctx, try_catch);
+  }
+  return (ValueTuple){nullptr, 0, nullptr};
+}
+
+ModuleTuple v8_Context_CompileModule(ContextPtr ctxptr, const char* code, const char* name) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::ScriptOrigin origin(
+      v8::String::NewFromUtf8(isolate, name),
+      v8::Integer::New(isolate, 0),  // line offset
+      v8::Integer::New(isolate, 0),  // column offset
+      v8::False(isolate),            // is shared cross-origin
+      v8::Local<v8::Integer>(),      // script id
+      v8::Local<v8::Value>(),        // source map url
+      v8::False(isolate),            // is opaque
+      v8::False(isolate),            // is wasm
+      v8::True(isolate));            // is module
+  v8::ScriptCompiler::Source source(v8::String::NewFromUtf8(isolate, code), origin);
+
+  v8::Local<v8::Module> compiled;
+  if (!v8::ScriptCompiler::CompileModule(isolate, &source).ToLocal(&compiled)) {
+    ValueTuple err = exception_tuple(isolate, ctx, try_catch);
+    return (ModuleTuple){nullptr, nullptr, 0, err.error_msg, err.exception};
+  }
+
+  Module* module = new Module;
+  module->ptr.Reset(isolate, compiled);
+  static_cast<Context*>(ctxptr)->modules.push_back(module);
+
+  ModuleTuple res = {module, nullptr, compiled->GetModuleRequestsLength(), nullptr, nullptr};
+  if (res.NumRequests > 0) {
+    res.Requests = static_cast<String*>(calloc(res.NumRequests, sizeof(String)));
+    for (int i = 0; i < res.NumRequests; i++) {
+      res.Requests[i] = DupString(compiled->GetModuleRequest(i));
+    }
+  }
+  return res;
+}
+
+void v8_Module_SetDependency(ModulePtr moduleptr, const char* specifier, ModulePtr dependency) {
+  static_cast<Module*>(moduleptr)->dependencies[specifier] = static_cast<Module*>(dependency);
+}
+
+ValueTuple v8_Module_Evaluate(ContextPtr ctxptr, ModulePtr moduleptr) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::Local<v8::Module> module = static_cast<Module*>(moduleptr)->ptr.Get(isolate);
+  if (module->GetStatus() < v8::Module::kInstantiated &&
+      module->InstantiateModule(ctx, resolve_module).IsNothing()) {
+    return exception_tuple(isolate, ctx, try_catch);
+  }
+  if (module->Evaluate(ctx).IsEmpty()) {
+    return exception_tuple(isolate, ctx, try_catch);
+  }
+
+  v8::Local<v8::Value> ns = module->GetModuleNamespace();
+  return (ValueTuple){new Value(isolate, ns), v8_Value_KindsFromLocal(ns), nullptr};
+}
+
+ScriptTuple v8_Context_Compile(ContextPtr ctxptr, const char* code, const char* filename,
+                               ByteArray cache) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::ScriptCompiler::CompileOptions options = v8::ScriptCompiler::kNoCompileOptions;
+  v8::ScriptCompiler::CachedData* cached_data = nullptr;
+  if (cache.ptr != nullptr && cache.len > 0) {
+    // The source takes ownership of cached_data, but not of the buffer.
+    cached_data = new v8::ScriptCompiler::CachedData(
+        reinterpret_cast<const uint8_t*>(cache.ptr), cache.len);
+    options = v8::ScriptCompiler::kConsumeCodeCache;
+  }
+  v8::ScriptCompiler::Source source(
+      v8::String::NewFromUtf8(isolate, code),
+      v8::ScriptOrigin(v8::String::NewFromUtf8(isolate, filename)),
+      cached_data);
+
+  v8::Local<v8::UnboundScript> script;
+  if (!v8::ScriptCompiler::CompileUnboundScript(isolate, &source, options).ToLocal(&script)) {
+    ValueTuple err = exception_tuple(isolate, ctx, try_catch);
+    return (ScriptTuple){nullptr, 0, err.error_msg, err.exception};
+  }
+
+  int rejected = cached_data != nullptr && source.GetCachedData()->rejected;
+  return (ScriptTuple){new UnboundScript(isolate, script), rejected, nullptr, nullptr};
+}
+
+ValueTuple v8_Script_Run(ContextPtr ctxptr, ScriptPtr scriptptr) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::Local<v8::Script> script =
+      static_cast<UnboundScript*>(scriptptr)->Get(isolate)->BindToCurrentContext();
+  v8::Local<v8::Value> result;
+  if (!script->Run(ctx).ToLocal(&result)) {
+    return exception_tuple(isolate, ctx, try_catch);
+  }
+  return (ValueTuple){new Value(isolate, result), v8_Value_KindsFromLocal(result), nullptr};
+}
+
+ByteArray v8_Script_CodeCache(ContextPtr ctxptr, ScriptPtr scriptptr,
+                              const char* code, const char* filename) {
+  VALUE_SCOPE(ctxptr);
+
+  v8::Local<v8::String> source_string = v8::String::NewFromUtf8(isolate, code);
+#if V8_MAJOR_VERSION > 6 || (V8_MAJOR_VERSION == 6 && V8_MINOR_VERSION >= 6)
+  v8::Local<v8::UnboundScript> script = static_cast<UnboundScript*>(scriptptr)->Get(isolate);
+  std::unique_ptr<v8::ScriptCompiler::CachedData> cached_data(
+      v8::ScriptCompiler::CreateCodeCache(script, source_string));
+  const v8::ScriptCompiler::CachedData* data = cached_data.get();
+#else
+  // Older versions can only produce the code cache while compiling.
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+  v8::ScriptCompiler::Source source(
+      source_string, v8::ScriptOrigin(v8::String::NewFromUtf8(isolate, filename)));
+  v8::ScriptCompiler::CompileUnboundScript(
+      isolate, &source, v8::ScriptCompiler::kProduceCodeCache);
+  const v8::ScriptCompiler::CachedData* data = source.GetCachedData();
+#endif
+
+  if (data == nullptr || data->length <= 0) {
+    return (ByteArray){nullptr, 0};
+  }
+  char* buf = static_cast<char*>(malloc(data->length));
+  memcpy(buf, data->data, data->length);
+  return (ByteArray){buf, data->length};
+}
+
+InspectorPtr v8_Inspector_New(IsolatePtr isolate_ptr, int id, int pausable) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  return static_cast<InspectorPtr>(new Inspector(isolate, id, pausable != 0));
+}
+
+void v8_Inspector_Dispatch(IsolatePtr isolate_ptr, InspectorPtr inspector_ptr, const char* msg) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  static_cast<Inspector*>(inspector_ptr)->Dispatch(msg);
+}
+
+void v8_Inspector_RequestDispatch(IsolatePtr isolate_ptr, int id) {
+  v8::Isolate* isolate = static_cast<v8::Isolate*>(isolate_ptr);
+  isolate->RequestInterrupt(inspector_dispatch_interrupt,
+                            reinterpret_cast<void*>(static_cast<intptr_t>(id)));
+}
+
+void v8_Inspector_SchedulePause(IsolatePtr isolate_ptr, InspectorPtr inspector_ptr,
+                                const char* reason) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  static_cast<Inspector*>(inspector_ptr)->SchedulePause(reason);
+}
+
+void v8_Inspector_Release(IsolatePtr isolate_ptr, InspectorPtr inspector_ptr) {
+  if (isolate_ptr == nullptr || inspector_ptr == nullptr) {
+    return;
+  }
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  delete static_cast<Inspector*>(inspector_ptr);
+}
+
+StackTrace v8_Context_CurrentStack(ContextPtr ctxptr) {
+  ISOLATE_SCOPE(static_cast<Context*>(ctxptr)->isolate);
+  v8::HandleScope handle_scope(isolate);
+  return stack_trace(v8::StackTrace::CurrentStackTrace(isolate, 64));
+}
+
+Exception* v8_Isolate_CheckSyntax(IsolatePtr isolate_ptr, const char* code, const char* filename) {
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  v8::HandleScope handle_scope(isolate);
+  // A context is only needed to extract the error location.
+  v8::Local<v8::Context> ctx = v8::Context::New(isolate);
+  v8::Context::Scope context_scope(ctx);
+
+  v8::TryCatch try_catch(isolate);
+  try_catch.SetVerbose(false);
+
+  v8::ScriptCompiler::Source source(
+      v8::String::NewFromUtf8(isolate, code),
+      v8::ScriptOrigin(v8::String::NewFromUtf8(isolate, filename)));
+  if (!v8::ScriptCompiler::CompileUnboundScript(isolate, &source).IsEmpty()) {
+    return nullptr;
+  }
+
+  // The thrown value belongs to the temporary context, so don't return it.
+  return detached_exception(isolate, ctx, try_catch);
+}
+
+void v8_Script_Release(IsolatePtr isolate_ptr, ScriptPtr scriptptr) {
+  if (isolate_ptr == nullptr || scriptptr == nullptr) {
+    return;
+  }
+  ISOLATE_SCOPE(static_cast<v8::Isolate*>(isolate_ptr));
+  UnboundScript* script = static_cast<UnboundScript*>(scriptptr);
+  script->Reset();
+  delete script;
+}
+
 } // extern "C"
@@ -11,6 +11,10 @@ extern "C" {
 typedef void* IsolatePtr;
 typedef void* ContextPtr;
 typedef void* PersistentValuePtr;
+typedef void* ModulePtr;
+typedef void* ScriptPtr;
+typedef void* LockerPtr;
+typedef void* InspectorPtr;
 
 typedef struct {
     const char* ptr;
@@ -33,6 +37,76 @@ typedef struct {
     size_t does_zap_garbage;
 } HeapStatistics;
 
+typedef struct {
+    String space_name;
+    size_t space_size;
+    size_t space_used_size;
+    size_t space_available_size;
+    size_t physical_space_size;
+} HeapSpaceStatistics;
+
+// HeapSpaceStatisticsList and its names are malloc'd and must be freed by the
+// receiver.
+typedef struct {
+    HeapSpaceStatistics* spaces;
+    int num_spaces;
+} HeapSpaceStatisticsList;
+
+typedef struct {
+    size_t code_and_metadata_size;
+    size_t bytecode_and_metadata_size;
+} HeapCodeStatistics;
+
+typedef enum {
+    kCPUProfileStarted = 0,
+    kCPUProfileNotLocked,    // The calling thread doesn't hold the isolate's lock.
+    kCPUProfileOtherThread,  // Other profiles sample another thread.
+} CPUProfileStart;
+
+// NOTE! These values must exactly match the values of GCType in v8_heap.go.
+typedef enum {
+    kGCScavenge = 0,
+    kGCMinorMarkCompact,
+    kGCMarkSweepCompact,
+    kGCIncrementalMarking,
+    kGCProcessWeakCallbacks,
+    kNumGCTypes,
+} GCType;
+
+typedef struct {
+    GCType type;
+    int forced;
+    double duration;  // In seconds.
+    size_t used_heap_size_before;
+    size_t used_heap_size_after;
+} GCEvent;
+
+// CPUProfileNode is a node of a CPU profile's call tree, whose nodes are
+// stored in depth-first order.
+typedef struct {
+    int Id;
+    int Parent;       // The index of the parent node, -1 for the root.
+    String FunctionName;
+    String ScriptName;
+    int ScriptId;
+    int LineNumber;   // 1-based, of the function.
+    int ColumnNumber;
+    unsigned HitCount;
+    String BailoutReason;
+} CPUProfileNode;
+
+// CPUProfile is a CPU profile. It and all of its arrays and strings are
+// malloc'd and must be freed by the receiver.
+typedef struct {
+    CPUProfileNode* Nodes;
+    int NumNodes;
+    int* Samples;          // The node id of each sample.
+    int64_t* Timestamps;   // Of each sample, in microseconds.
+    int NumSamples;
+    int64_t StartTime;     // In microseconds.
+    int64_t EndTime;
+} CPUProfile;
+
 // NOTE! These values must exactly match the values in kinds.go. Any mismatch
 // will cause kinds to be misreported.
 typedef enum {
@@ -91,35 +165,124 @@ typedef enum {
 // to multiple bitmasks or a dynamically-allocated array.
 typedef uint64_t KindMask;
 
+typedef struct {
+    String Funcname;
+    String Filename;
+    int Line;
+    int Column;
+} CallerInfo;
+
+// Exception describes a javascript exception. All of the strings and the
+// Frames array are malloc'd and must be freed by the receiver.
+typedef struct {
+    PersistentValuePtr Value; // The thrown value, null if execution was terminated.
+    KindMask Kinds;
+    String Name;              // e.g. "TypeError", empty if not an Error object.
+    String Message;
+    String SourceLine;
+    CallerInfo Location;      // Where the exception was thrown.
+    CallerInfo* Frames;
+    int NumFrames;
+} Exception;
+
 typedef struct {
     PersistentValuePtr Value;
     KindMask Kinds;
     Error error_msg;
+    Exception* exception; // Set (and malloc'd) only if javascript threw.
 } ValueTuple;
 
+// StackTrace is a javascript call stack, innermost frame first. The Frames
+// array and its strings are malloc'd and must be freed by the receiver.
 typedef struct {
-    String Funcname;
-    String Filename;
-    int Line;
-    int Column;
-} CallerInfo;
+    CallerInfo* Frames;
+    int NumFrames;
+} StackTrace;
+
+typedef struct {
+    ModulePtr Module;
+    String* Requests; // The import specifiers, malloc'd along with their strings.
+    int NumRequests;
+    Error error_msg;
+    Exception* exception;
+} ModuleTuple;
+
+typedef struct {
+    ScriptPtr Script;
+    int CacheRejected;
+    Error error_msg;
+    Exception* exception;
+} ScriptTuple;
+
+typedef struct {
+    const char* js;
+    const char* filename;
+    const char* warm_up;          // May be null.
+    const char* warm_up_filename;
+} SnapshotContext;
+
+typedef struct {
+    StartupData data;
+    Error error_msg;
+    Exception* exception; // Without Value.
+} SnapshotTuple;
 
 typedef struct { int Major, Minor, Build, Patch; } Version;
 extern Version version;
 
 // typedef unsigned int uint32_t;
 
+// IsolateOptions configures the resource limits of an isolate. Zero values use
+// V8's defaults.
+typedef struct {
+    size_t MaxHeapBytes;
+    size_t MaxYoungGenBytes;
+    size_t StackLimit;
+} IsolateOptions;
+
 // v8_init must be called once before anything else.
 extern void v8_init();
 
 extern StartupData v8_CreateSnapshotDataBlob(const char* js);
+// The first context is the snapshot's default context.
+extern SnapshotTuple v8_CreateSnapshot(SnapshotContext* contexts, int num_contexts,
+                                       const char** callback_names, int num_callbacks,
+                                       int keep_function_code);
 
-extern IsolatePtr v8_Isolate_New(StartupData data);
-extern ContextPtr v8_Isolate_NewContext(IsolatePtr isolate);
+extern IsolatePtr v8_Isolate_New(StartupData data, IsolateOptions opts);
+extern ContextPtr v8_Isolate_NewContext(IsolatePtr isolate, int id);
+extern ContextPtr v8_Isolate_NewContextFromSnapshot(IsolatePtr isolate, int index, int id);
 extern void       v8_Isolate_Terminate(IsolatePtr isolate);
+extern void       v8_Isolate_CancelTerminate(IsolatePtr isolate);
+extern void       v8_Isolate_RunMicrotasks(IsolatePtr isolate);
+extern int        v8_Isolate_TakeHeapLimitExceeded(IsolatePtr isolate);
 extern void       v8_Isolate_Release(IsolatePtr isolate);
 
+// v8_Isolate_Lock locks the isolate to the calling thread until the returned
+// locker is passed to v8_Isolate_Unlock, which must be called on the same
+// thread.
+extern LockerPtr  v8_Isolate_Lock(IsolatePtr isolate);
+extern void       v8_Isolate_Unlock(LockerPtr locker);
+
+// v8_Isolate_RequestInterrupt makes the isolate call go_interrupt_handler with
+// the id and the executing Context, if any, at the next interrupt check. It may
+// be called from any thread.
+extern void       v8_Isolate_RequestInterrupt(IsolatePtr isolate, int id);
+
 extern HeapStatistics       v8_Isolate_GetHeapStatistics(IsolatePtr isolate);
+extern HeapSpaceStatisticsList v8_Isolate_GetHeapSpaceStatistics(IsolatePtr isolate);
+extern HeapCodeStatistics   v8_Isolate_GetHeapCodeStatistics(IsolatePtr isolate);
+// v8_Isolate_AddGCCallbacks makes the isolate call go_gc_handler with the id
+// after every garbage collection.
+extern void                 v8_Isolate_AddGCCallbacks(IsolatePtr isolate, int id);
+// v8_Isolate_StartCPUProfile starts profiling the calling thread, which must
+// hold the isolate's lock.
+extern CPUProfileStart      v8_Isolate_StartCPUProfile(IsolatePtr isolate, const char* name);
+// Returns null if no profile with that name was started.
+extern CPUProfile*          v8_Isolate_StopCPUProfile(IsolatePtr isolate, const char* name);
+// v8_Isolate_WriteHeapSnapshot takes a heap snapshot and passes its JSON to
+// go_heap_snapshot_write with the id, chunk by chunk.
+extern void                 v8_Isolate_WriteHeapSnapshot(IsolatePtr isolate, int id);
 extern void                 v8_Isolate_LowMemoryNotification(IsolatePtr isolate);
 
 extern ValueTuple     v8_Context_Run(ContextPtr ctx,
@@ -154,10 +317,10 @@ typedef struct {
 extern PersistentValuePtr v8_Context_Create(ContextPtr ctx, ImmediateValue val);
 
 extern ValueTuple  v8_Value_Get(ContextPtr ctx, PersistentValuePtr value, const char* field);
-extern Error       v8_Value_Set(ContextPtr ctx, PersistentValuePtr value,
+extern ValueTuple  v8_Value_Set(ContextPtr ctx, PersistentValuePtr value,
                                 const char* field, PersistentValuePtr new_value);
 extern ValueTuple  v8_Value_GetIdx(ContextPtr ctx, PersistentValuePtr value, int idx);
-extern Error       v8_Value_SetIdx(ContextPtr ctx, PersistentValuePtr value,
+extern ValueTuple  v8_Value_SetIdx(ContextPtr ctx, PersistentValuePtr value,
                                    int idx, PersistentValuePtr new_value);
 extern ValueTuple  v8_Value_Call(ContextPtr ctx,
                                  PersistentValuePtr func,
@@ -174,9 +337,51 @@ extern int64_t   v8_Value_Int64(ContextPtr ctx, PersistentValuePtr value);
 extern int       v8_Value_Bool(ContextPtr ctx, PersistentValuePtr value);
 extern ByteArray v8_Value_Bytes(ContextPtr ctx, PersistentValuePtr value);
 
+extern ValueTuple v8_Value_Keys(ContextPtr ctx, PersistentValuePtr value);
+extern ValueTuple v8_Value_AsArray(ContextPtr ctx, PersistentValuePtr value);
+extern int        v8_Value_StrictEquals(ContextPtr ctx, PersistentValuePtr a,
+                                        PersistentValuePtr b);
+
 extern ValueTuple v8_Value_PromiseInfo(ContextPtr ctx, PersistentValuePtr value,
                                        int* promise_state);
 
+extern ValueTuple v8_Context_NewResolver(ContextPtr ctx);
+extern ValueTuple v8_Resolver_GetPromise(ContextPtr ctx, PersistentValuePtr resolver);
+extern ValueTuple v8_Resolver_Resolve(ContextPtr ctx, PersistentValuePtr resolver,
+                                      PersistentValuePtr value);
+extern ValueTuple v8_Resolver_Reject(ContextPtr ctx, PersistentValuePtr resolver,
+                                     PersistentValuePtr value);
+
+extern ModuleTuple v8_Context_CompileModule(ContextPtr ctx,
+                                            const char* code, const char* name);
+extern void        v8_Module_SetDependency(ModulePtr module, const char* specifier,
+                                           ModulePtr dependency);
+extern ValueTuple  v8_Module_Evaluate(ContextPtr ctx, ModulePtr module);
+
+extern ScriptTuple v8_Context_Compile(ContextPtr ctx, const char* code,
+                                      const char* filename, ByteArray cache);
+extern ValueTuple  v8_Script_Run(ContextPtr ctx, ScriptPtr script);
+extern ByteArray   v8_Script_CodeCache(ContextPtr ctx, ScriptPtr script,
+                                       const char* code, const char* filename);
+extern void        v8_Script_Release(IsolatePtr isolate, ScriptPtr script);
+extern StackTrace  v8_Context_CurrentStack(ContextPtr ctx);
+
+// An inspector exchanges Chrome DevTools Protocol messages for all of the
+// isolate's contexts with the Go inspector with the same id, see
+// go_inspector_*. Only pausable inspectors, i.e. debuggers, run the message
+// loop while the javascript is paused.
+extern InspectorPtr v8_Inspector_New(IsolatePtr isolate, int id, int pausable);
+extern void         v8_Inspector_Dispatch(IsolatePtr isolate, InspectorPtr inspector,
+                                          const char* msg);
+// v8_Inspector_RequestDispatch calls go_inspector_dispatch with the id at the
+// isolate's next interrupt check. It may be called from any thread.
+extern void         v8_Inspector_RequestDispatch(IsolatePtr isolate, int id);
+extern void         v8_Inspector_SchedulePause(IsolatePtr isolate, InspectorPtr inspector,
+                                               const char* reason);
+extern void         v8_Inspector_Release(IsolatePtr isolate, InspectorPtr inspector);
+extern Exception*  v8_Isolate_CheckSyntax(IsolatePtr isolate,
+                                          const char* code, const char* filename);
+
 #ifdef __cplusplus
 }
 #endif
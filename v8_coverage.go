@@ -0,0 +1,213 @@
+package v8
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ScriptCoverage is the coverage of a script, as collected by
+// TakePreciseCoverage.
+type ScriptCoverage struct {
+	ScriptID string
+	// URL is the filename that was passed to Eval, Compile, etc.
+	URL    string
+	Source string
+	// Functions are the script's functions that have been compiled, starting
+	// with the script's top-level code, whose range covers the whole script.
+	Functions []FunctionCoverage
+}
+
+// FunctionCoverage is the coverage of a function.
+type FunctionCoverage struct {
+	FunctionName string
+	// Ranges are the ranges of the function's source code with their counts.
+	// The first one is the whole function; the others are nested blocks whose
+	// counts differ from the enclosing range's, if block coverage is detailed.
+	Ranges []CoverageRange
+	// IsBlockCoverage is whether the Ranges include blocks.
+	IsBlockCoverage bool
+}
+
+// CoverageRange is a range of a script's source code, in UTF-16 code units
+// like javascript string indexes, with the number of times it was executed.
+type CoverageRange struct {
+	StartOffset int
+	EndOffset   int
+	Count       int
+}
+
+// coverage collects precise coverage through an Inspector of its own, which
+// sees the scripts of all of the isolate's Contexts.
+type coverage struct {
+	in       *Inspector
+	nextId   int
+	response []byte
+	sources  map[string]string // by script id
+}
+
+// StartPreciseCoverage starts collecting precise code coverage of all the
+// javascript that the Isolate runs from now on, until StopPreciseCoverage. If
+// callCount is false, the counts only tell whether the code ran (1) or not
+// (0), which is cheaper. If detailed is true, the coverage includes blocks,
+// e.g. the branches of if statements, rather than only functions.
+//
+// Coverage is collected with an inspector session of its own, so it may be
+// collected while a debugger is attached, but a debugger that starts or stops
+// precise coverage itself affects both. The Isolate isn't garbage collected
+// until StopPreciseCoverage is called.
+func (i *Isolate) StartPreciseCoverage(callCount, detailed bool) error {
+	i.coverageMutex.Lock()
+	defer i.coverageMutex.Unlock()
+	if i.coverage == nil {
+		c := &coverage{sources: map[string]string{}}
+		c.in = newInspector(i, c, false)
+		// The debugger provides the scripts' sources. It must not pause at
+		// debugger statements, since nobody would resume the javascript.
+		for _, method := range []string{"Profiler.enable", "Debugger.enable"} {
+			if err := c.call(method, nil, nil); err != nil {
+				c.in.Close()
+				return err
+			}
+		}
+		if err := c.call("Debugger.setSkipAllPauses", map[string]bool{"skip": true}, nil); err != nil {
+			c.in.Close()
+			return err
+		}
+		i.coverage = c
+	}
+	return i.coverage.call("Profiler.startPreciseCoverage", map[string]bool{
+		"callCount": callCount,
+		"detailed":  detailed,
+	}, nil)
+}
+
+// TakePreciseCoverage returns the coverage collected since
+// StartPreciseCoverage or the previous TakePreciseCoverage, which resets the
+// counts. Scripts without a filename are omitted. See WriteLCOV and
+// WriteIstanbul to report it.
+func (i *Isolate) TakePreciseCoverage() ([]ScriptCoverage, error) {
+	i.coverageMutex.Lock()
+	defer i.coverageMutex.Unlock()
+	c := i.coverage
+	if c == nil {
+		return nil, errors.New("Precise coverage was not started")
+	}
+
+	var res struct {
+		Result []struct {
+			ScriptID  string `json:"scriptId"`
+			URL       string `json:"url"`
+			Functions []struct {
+				FunctionName string `json:"functionName"`
+				Ranges       []struct {
+					StartOffset int `json:"startOffset"`
+					EndOffset   int `json:"endOffset"`
+					Count       int `json:"count"`
+				} `json:"ranges"`
+				IsBlockCoverage bool `json:"isBlockCoverage"`
+			} `json:"functions"`
+		} `json:"result"`
+	}
+	if err := c.call("Profiler.takePreciseCoverage", nil, &res); err != nil {
+		return nil, err
+	}
+
+	var scripts []ScriptCoverage
+	for _, r := range res.Result {
+		if r.URL == "" {
+			continue
+		}
+		source, err := c.source(r.ScriptID)
+		if err != nil {
+			return nil, err
+		}
+		script := ScriptCoverage{ScriptID: r.ScriptID, URL: r.URL, Source: source}
+		for _, f := range r.Functions {
+			fc := FunctionCoverage{FunctionName: f.FunctionName, IsBlockCoverage: f.IsBlockCoverage}
+			for _, rg := range f.Ranges {
+				fc.Ranges = append(fc.Ranges, CoverageRange(rg))
+			}
+			script.Functions = append(script.Functions, fc)
+		}
+		scripts = append(scripts, script)
+	}
+	return scripts, nil
+}
+
+// StopPreciseCoverage stops collecting coverage and discards the coverage
+// that was not taken yet.
+func (i *Isolate) StopPreciseCoverage() {
+	i.coverageMutex.Lock()
+	defer i.coverageMutex.Unlock()
+	if i.coverage == nil {
+		return
+	}
+	i.coverage.call("Profiler.stopPreciseCoverage", nil, nil)
+	i.coverage.in.Close()
+	i.coverage = nil
+}
+
+// source returns the source code of the script.
+func (c *coverage) source(scriptId string) (string, error) {
+	if source, ok := c.sources[scriptId]; ok {
+		return source, nil
+	}
+	var res struct {
+		ScriptSource string `json:"scriptSource"`
+	}
+	if err := c.call("Debugger.getScriptSource", map[string]string{"scriptId": scriptId}, &res); err != nil {
+		return "", err
+	}
+	c.sources[scriptId] = res.ScriptSource
+	return res.ScriptSource, nil
+}
+
+// call calls the Chrome DevTools Protocol method and unmarshals its result
+// into result, if not nil.
+func (c *coverage) call(method string, params interface{}, result interface{}) error {
+	c.nextId++
+	msg, err := json.Marshal(struct {
+		ID     int         `json:"id"`
+		Method string      `json:"method"`
+		Params interface{} `json:"params,omitempty"`
+	}{c.nextId, method, params})
+	if err != nil {
+		return err
+	}
+	c.response = nil
+	c.in.dispatchNow(string(msg))
+	if c.response == nil {
+		return errors.New("No response to " + method)
+	}
+
+	var res struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(c.response, &res); err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return errors.New(method + ": " + res.Error.Message)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(res.Result, result)
+}
+
+// Send receives the Inspector's messages, which it sends while dispatching
+// the calls.
+func (c *coverage) Send(msg string) {
+	var m struct {
+		ID int `json:"id"`
+	}
+	// Notifications, e.g. Debugger.scriptParsed, have no id.
+	if json.Unmarshal([]byte(msg), &m) == nil && m.ID == c.nextId {
+		c.response = []byte(msg)
+	}
+}
+
+func (c *coverage) RunIfWaitingForDebugger() {}
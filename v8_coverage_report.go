@@ -0,0 +1,265 @@
+package v8
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// WriteLCOV writes the coverage in the LCOV tracefile format, e.g. for genhtml
+// or coverage services, with the line and function counts of each file. The
+// files are the filenames passed to Eval, Compile, etc., and the coverage of
+// scripts with the same filename is merged. A line's count is the count of the
+// innermost range that contains the line's first non-blank character.
+func WriteLCOV(w io.Writer, scripts []ScriptCoverage) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range fileCoverages(scripts) {
+		fmt.Fprintf(bw, "TN:\nSF:%s\n", f.path)
+		hit := 0
+		for _, fn := range f.functions {
+			fmt.Fprintf(bw, "FN:%d,%s\n", fn.start.Line, fn.name)
+		}
+		for _, fn := range f.functions {
+			fmt.Fprintf(bw, "FNDA:%d,%s\n", fn.count, fn.name)
+			if fn.count > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "FNF:%d\nFNH:%d\n", len(f.functions), hit)
+		hit = 0
+		for _, l := range f.lines {
+			fmt.Fprintf(bw, "DA:%d,%d\n", l.start.Line, l.count)
+			if l.count > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(f.lines), hit)
+	}
+	return bw.Flush()
+}
+
+// WriteIstanbul writes the coverage in the JSON format of Istanbul's
+// coverage-final.json, e.g. for nyc report, keyed by file like WriteLCOV. Each
+// non-blank line is a statement; branches are not reported.
+func WriteIstanbul(w io.Writer, scripts []ScriptCoverage) error {
+	type loc struct {
+		Start coveragePosition `json:"start"`
+		End   coveragePosition `json:"end"`
+	}
+	type fn struct {
+		Name string `json:"name"`
+		Decl loc    `json:"decl"`
+		Loc  loc    `json:"loc"`
+		Line int    `json:"line"`
+	}
+	type file struct {
+		Path         string              `json:"path"`
+		StatementMap map[string]loc      `json:"statementMap"`
+		S            map[string]int      `json:"s"`
+		FnMap        map[string]fn       `json:"fnMap"`
+		F            map[string]int      `json:"f"`
+		BranchMap    map[string]struct{} `json:"branchMap"`
+		B            map[string][]int    `json:"b"`
+	}
+
+	files := map[string]file{}
+	for _, f := range fileCoverages(scripts) {
+		out := file{
+			Path:         f.path,
+			StatementMap: map[string]loc{},
+			S:            map[string]int{},
+			FnMap:        map[string]fn{},
+			F:            map[string]int{},
+			BranchMap:    map[string]struct{}{},
+			B:            map[string][]int{},
+		}
+		for i, l := range f.lines {
+			key := strconv.Itoa(i)
+			out.StatementMap[key] = loc{l.start, l.end}
+			out.S[key] = l.count
+		}
+		for i, c := range f.functions {
+			key := strconv.Itoa(i)
+			out.FnMap[key] = fn{
+				Name: c.name,
+				Decl: loc{c.start, c.start},
+				Loc:  loc{c.start, c.end},
+				Line: c.start.Line,
+			}
+			out.F[key] = c.count
+		}
+		files[f.path] = out
+	}
+	return json.NewEncoder(w).Encode(files)
+}
+
+// coveragePosition is a position in a file, with a 1-based line and a 0-based
+// column, which counts UTF-16 code units.
+type coveragePosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// coveredSpan is a line or a function of a file and its count.
+type coveredSpan struct {
+	name       string
+	start, end coveragePosition
+	count      int
+}
+
+type fileCoverage struct {
+	path      string
+	lines     []coveredSpan // by line
+	functions []coveredSpan // by position
+}
+
+// fileCoverages returns the line and function coverage of the scripts by
+// file, sorted by path.
+func fileCoverages(scripts []ScriptCoverage) []fileCoverage {
+	type fileCounts struct {
+		lines     map[int]*coveredSpan
+		functions map[coveragePosition]*coveredSpan
+	}
+	files := map[string]*fileCounts{}
+	for _, script := range scripts {
+		fc := files[script.URL]
+		if fc == nil {
+			fc = &fileCounts{map[int]*coveredSpan{}, map[coveragePosition]*coveredSpan{}}
+			files[script.URL] = fc
+		}
+		src := newCoverageSource(script.Source)
+
+		var ranges []CoverageRange
+		for _, f := range script.Functions {
+			ranges = append(ranges, f.Ranges...)
+		}
+		for _, l := range src.lines() {
+			count, ok := innermostCount(ranges, l.first)
+			if !ok {
+				continue
+			}
+			if span := fc.lines[l.start.Line]; span != nil {
+				span.count += count
+			} else {
+				fc.lines[l.start.Line] = &coveredSpan{start: l.start, end: l.end, count: count}
+			}
+		}
+
+		anonymous := 0
+		for i, f := range script.Functions {
+			if len(f.Ranges) == 0 {
+				continue
+			}
+			r := f.Ranges[0]
+			if i == 0 && f.FunctionName == "" && r.StartOffset == 0 {
+				continue // the script's top-level code
+			}
+			start := src.position(r.StartOffset)
+			if span := fc.functions[start]; span != nil {
+				span.count += r.Count
+				continue
+			}
+			name := f.FunctionName
+			if name == "" {
+				name = fmt.Sprintf("(anonymous_%d)", anonymous)
+				anonymous++
+			}
+			fc.functions[start] = &coveredSpan{name, start, src.position(r.EndOffset), r.Count}
+		}
+	}
+
+	var res []fileCoverage
+	for path, fc := range files {
+		f := fileCoverage{path: path}
+		for _, span := range fc.lines {
+			f.lines = append(f.lines, *span)
+		}
+		for _, span := range fc.functions {
+			f.functions = append(f.functions, *span)
+		}
+		sort.Slice(f.lines, func(i, j int) bool { return f.lines[i].start.Line < f.lines[j].start.Line })
+		sort.Slice(f.functions, func(i, j int) bool { return f.functions[i].start.less(f.functions[j].start) })
+		res = append(res, f)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].path < res[j].path })
+	return res
+}
+
+func (p coveragePosition) less(q coveragePosition) bool {
+	return p.Line < q.Line || (p.Line == q.Line && p.Column < q.Column)
+}
+
+// innermostCount returns the count of the smallest range that contains the
+// offset. V8 nests block ranges within their functions', and a nested range
+// overrides the count of the enclosing ones.
+func innermostCount(ranges []CoverageRange, offset int) (count int, ok bool) {
+	size := -1
+	for _, r := range ranges {
+		if r.StartOffset <= offset && offset < r.EndOffset &&
+			(size < 0 || r.EndOffset-r.StartOffset <= size) {
+			count, size, ok = r.Count, r.EndOffset-r.StartOffset, true
+		}
+	}
+	return count, ok
+}
+
+// coverageSource maps the UTF-16 offsets of coverage ranges to positions.
+type coverageSource struct {
+	units      []uint16
+	lineStarts []int // offsets
+}
+
+func newCoverageSource(source string) *coverageSource {
+	s := &coverageSource{units: utf16.Encode([]rune(source)), lineStarts: []int{0}}
+	for i, u := range s.units {
+		if u == '\n' {
+			s.lineStarts = append(s.lineStarts, i+1)
+		}
+	}
+	return s
+}
+
+func (s *coverageSource) position(offset int) coveragePosition {
+	line := sort.Search(len(s.lineStarts), func(i int) bool { return s.lineStarts[i] > offset })
+	return coveragePosition{Line: line, Column: offset - s.lineStarts[line-1]}
+}
+
+// coverageLine is a non-blank line of source code.
+type coverageLine struct {
+	first      int // the offset of its first non-blank character
+	start, end coveragePosition
+}
+
+func (s *coverageSource) lines() []coverageLine {
+	var lines []coverageLine
+	for i, start := range s.lineStarts {
+		end := len(s.units)
+		if i+1 < len(s.lineStarts) {
+			end = s.lineStarts[i+1]
+		}
+		first, last := start, end
+		for first < end && isBlank(s.units[first]) {
+			first++
+		}
+		for last > first && isBlank(s.units[last-1]) {
+			last--
+		}
+		if first == end {
+			continue
+		}
+		lines = append(lines, coverageLine{
+			first: first,
+			start: coveragePosition{i + 1, first - start},
+			end:   coveragePosition{i + 1, last - start},
+		})
+	}
+	return lines
+}
+
+func isBlank(u uint16) bool {
+	return u == ' ' || u == '\t' || u == '\r' || u == '\n'
+}
@@ -0,0 +1,213 @@
+package v8
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const rulesJS = `function discount(total) {
+  if (total > 100) {
+    return 10;
+  } else {
+    return 0;
+  }
+}
+function unused() {
+  return 1;
+}
+`
+
+func TestPreciseCoverage(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+	if _, err := iso.TakePreciseCoverage(); err == nil {
+		t.Error("Expected an error before StartPreciseCoverage")
+	}
+	if err := iso.StartPreciseCoverage(true, true); err != nil {
+		t.Fatal(err)
+	}
+	defer iso.StopPreciseCoverage()
+
+	if _, err := ctx.Eval(rulesJS, "rules.js"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Eval(`discount(150); discount(200);`, "main.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts, err := iso.TakePreciseCoverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules *ScriptCoverage
+	for i := range scripts {
+		if scripts[i].URL == "rules.js" {
+			rules = &scripts[i]
+		}
+	}
+	if rules == nil {
+		t.Fatalf("Expected coverage of rules.js in %#v", scripts)
+	}
+	if rules.Source != rulesJS {
+		t.Errorf("Wrong source: %q", rules.Source)
+	}
+	counts := map[string]int{}
+	for _, f := range rules.Functions {
+		if !f.IsBlockCoverage || len(f.Ranges) == 0 {
+			t.Errorf("Expected block coverage: %#v", f)
+			continue
+		}
+		counts[f.FunctionName] = f.Ranges[0].Count
+	}
+	if counts["discount"] != 2 || counts["unused"] != 0 {
+		t.Errorf("Wrong function counts: %v", counts)
+	}
+
+	var lcov bytes.Buffer
+	if err := WriteLCOV(&lcov, scripts); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"SF:rules.js", "FN:1,discount", "FNDA:2,discount", "FNDA:0,unused",
+		"DA:3,2", "DA:5,0", "DA:9,0",
+	} {
+		if !strings.Contains(lcov.String(), line+"\n") {
+			t.Errorf("Expected %q in the LCOV:\n%s", line, lcov.String())
+		}
+	}
+
+	// The counts were reset.
+	if scripts, err = iso.TakePreciseCoverage(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range scripts {
+		for _, f := range s.Functions {
+			if f.FunctionName == "discount" && f.Ranges[0].Count != 0 {
+				t.Errorf("Expected the counts to be reset: %#v", f)
+			}
+		}
+	}
+}
+
+type nopInspectorHandler struct{}
+
+func (nopInspectorHandler) Send(msg string)          {}
+func (nopInspectorHandler) RunIfWaitingForDebugger() {}
+
+func TestPreciseCoverageWithInspector(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+	// Scripts of Contexts that exist before and after coverage starts, while
+	// a debugger is attached, are covered.
+	in := NewInspector(ctx, nopInspectorHandler{})
+	defer in.Close()
+	if _, err := ctx.Eval(rulesJS, "rules.js"); err != nil {
+		t.Fatal(err)
+	}
+	if err := iso.StartPreciseCoverage(true, false); err != nil {
+		t.Fatal(err)
+	}
+	defer iso.StopPreciseCoverage()
+	other := iso.NewContext()
+	if _, err := other.Eval(`function other() {} other();`, "other.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts, err := iso.TakePreciseCoverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{}
+	for _, s := range scripts {
+		sources[s.URL] = s.Source
+	}
+	if sources["rules.js"] != rulesJS || !strings.Contains(sources["other.js"], "other()") {
+		t.Errorf("Wrong scripts: %v", sources)
+	}
+}
+
+func TestCoverageReports(t *testing.T) {
+	t.Parallel()
+
+	script := ScriptCoverage{
+		URL:    "rules.js",
+		Source: rulesJS,
+		Functions: []FunctionCoverage{
+			{"", []CoverageRange{{0, 128, 1}}, true},
+			{"discount", []CoverageRange{{0, 93, 3}, {72, 89, 0}}, true},
+			{"unused", []CoverageRange{{94, 127, 0}}, true},
+		},
+	}
+	// Scripts with the same filename are merged.
+	scripts := []ScriptCoverage{script, script}
+
+	var lcov bytes.Buffer
+	if err := WriteLCOV(&lcov, scripts); err != nil {
+		t.Fatal(err)
+	}
+	expected := `TN:
+SF:rules.js
+FN:1,discount
+FN:8,unused
+FNDA:6,discount
+FNDA:0,unused
+FNF:2
+FNH:1
+DA:1,6
+DA:2,6
+DA:3,6
+DA:4,6
+DA:5,0
+DA:6,6
+DA:7,6
+DA:8,0
+DA:9,0
+DA:10,0
+LF:10
+LH:6
+end_of_record
+`
+	if lcov.String() != expected {
+		t.Errorf("Wrong LCOV:\n%s\nExpected:\n%s", lcov.String(), expected)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteIstanbul(&buf, scripts); err != nil {
+		t.Fatal(err)
+	}
+	var istanbul map[string]struct {
+		Path         string `json:"path"`
+		StatementMap map[string]struct {
+			Start coveragePosition `json:"start"`
+			End   coveragePosition `json:"end"`
+		} `json:"statementMap"`
+		S     map[string]int `json:"s"`
+		FnMap map[string]struct {
+			Name string `json:"name"`
+			Line int    `json:"line"`
+		} `json:"fnMap"`
+		F map[string]int `json:"f"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &istanbul); err != nil {
+		t.Fatal(err)
+	}
+	f, ok := istanbul["rules.js"]
+	if !ok || f.Path != "rules.js" || len(f.S) != 10 || len(f.F) != 2 {
+		t.Fatalf("Wrong Istanbul coverage: %s", buf.String())
+	}
+	if s := f.StatementMap["4"]; s.Start != (coveragePosition{5, 4}) || s.End != (coveragePosition{5, 13}) {
+		t.Errorf("Wrong statement: %#v", s)
+	}
+	if f.S["4"] != 0 || f.S["2"] != 6 {
+		t.Errorf("Wrong statement counts: %v", f.S)
+	}
+	if f.FnMap["1"].Name != "unused" || f.FnMap["1"].Line != 8 || f.F["0"] != 6 {
+		t.Errorf("Wrong functions: %#v %v", f.FnMap, f.F)
+	}
+}
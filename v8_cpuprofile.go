@@ -0,0 +1,354 @@
+package v8
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// CPUProfile is a CPU profile of the javascript that ran in an Isolate,
+// recorded by sampling its call stack periodically.
+type CPUProfile struct {
+	Name string
+	// Root is the root of the call tree, whose FunctionName is "(root)". Its
+	// children are the javascript entry points and some special nodes like
+	// "(program)" for time spent in V8 itself and "(garbage collector)".
+	Root *CPUProfileNode
+	// Samples are the node IDs of the sampled call stacks' innermost frames,
+	// in order.
+	Samples []int
+	// Timestamps are the times of the samples.
+	Timestamps []time.Duration
+	// StartTime and EndTime are the times that profiling started and stopped.
+	// Like the Timestamps, they're relative to an arbitrary point in time.
+	StartTime, EndTime time.Duration
+}
+
+// CPUProfileNode is a node of a CPUProfile's call tree: a function called
+// from the function of its parent node.
+type CPUProfileNode struct {
+	ID           int
+	FunctionName string
+	ScriptName   string
+	ScriptID     int
+	// LineNumber and ColumnNumber are where the function is defined. They
+	// are 1-based, or 0 if unknown.
+	LineNumber, ColumnNumber int
+	// HitCount is the number of samples in which this function was the
+	// innermost frame of this call stack.
+	HitCount int
+	// BailoutReason is why V8 didn't optimize the function, if it didn't.
+	BailoutReason string
+	Children      []*CPUProfileNode
+}
+
+// StartCPUProfile starts recording a CPU profile with the specified name.
+// Multiple profiles with different names may be recorded at the same time.
+//
+// V8 samples the OS thread that starts the profile, so StartCPUProfile must be
+// called within Do, and the javascript to profile must run within the same Do
+// call:
+//
+//     iso.Do(func() {
+//         if err := iso.StartCPUProfile("render"); err != nil { ... }
+//         ctx.Eval(`render()`, "render.js")
+//         profile = iso.StopCPUProfile("render")
+//     })
+//
+// Profiles recorded at the same time must be started within the same Do call.
+// V8 uses the SIGPROF signal for sampling, so don't record Go CPU profiles at
+// the same time.
+func (i *Isolate) StartCPUProfile(name string) error {
+	name_cstr := C.CString(name)
+	defer C.free(unsafe.Pointer(name_cstr))
+	switch C.v8_Isolate_StartCPUProfile(i.ptr, name_cstr) {
+	case C.kCPUProfileNotLocked:
+		return errors.New("Cannot start a CPU profile outside of Isolate.Do")
+	case C.kCPUProfileOtherThread:
+		return errors.New("Cannot start a CPU profile while others are recorded within another Do call")
+	}
+	return nil
+}
+
+// StopCPUProfile stops recording the named CPU profile and returns it, or nil
+// if no profile with that name was started.
+func (i *Isolate) StopCPUProfile(name string) *CPUProfile {
+	name_cstr := C.CString(name)
+	defer C.free(unsafe.Pointer(name_cstr))
+	profile := C.v8_Isolate_StopCPUProfile(i.ptr, name_cstr)
+	if profile == nil {
+		return nil
+	}
+	defer C.free(unsafe.Pointer(profile))
+
+	p := &CPUProfile{
+		Name:      name,
+		StartTime: time.Duration(profile.StartTime) * time.Microsecond,
+		EndTime:   time.Duration(profile.EndTime) * time.Microsecond,
+	}
+
+	n := int(profile.NumNodes)
+	cnodes := (*[1 << 28]C.CPUProfileNode)(unsafe.Pointer(profile.Nodes))[:n:n]
+	nodes := make([]*CPUProfileNode, n)
+	for j, cn := range cnodes {
+		nodes[j] = &CPUProfileNode{
+			ID:            int(cn.Id),
+			FunctionName:  takeString(cn.FunctionName),
+			ScriptName:    takeString(cn.ScriptName),
+			ScriptID:      int(cn.ScriptId),
+			LineNumber:    int(cn.LineNumber),
+			ColumnNumber:  int(cn.ColumnNumber),
+			HitCount:      int(cn.HitCount),
+			BailoutReason: takeString(cn.BailoutReason),
+		}
+		if cn.Parent >= 0 {
+			parent := nodes[cn.Parent]
+			parent.Children = append(parent.Children, nodes[j])
+		}
+	}
+	C.free(unsafe.Pointer(profile.Nodes))
+	if n > 0 {
+		p.Root = nodes[0]
+	}
+
+	if ns := int(profile.NumSamples); ns > 0 {
+		samples := (*[1 << 28]C.int)(unsafe.Pointer(profile.Samples))[:ns:ns]
+		timestamps := (*[1 << 28]C.int64_t)(unsafe.Pointer(profile.Timestamps))[:ns:ns]
+		p.Samples = make([]int, ns)
+		p.Timestamps = make([]time.Duration, ns)
+		for j := range samples {
+			p.Samples[j] = int(samples[j])
+			p.Timestamps[j] = time.Duration(timestamps[j]) * time.Microsecond
+		}
+		C.free(unsafe.Pointer(profile.Samples))
+		C.free(unsafe.Pointer(profile.Timestamps))
+	}
+	return p
+}
+
+// Walk calls f for each node of the profile's call tree, parents before their
+// children.
+func (p *CPUProfile) Walk(f func(node *CPUProfileNode)) {
+	var walk func(*CPUProfileNode)
+	walk = func(node *CPUProfileNode) {
+		f(node)
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	if p.Root != nil {
+		walk(p.Root)
+	}
+}
+
+// WriteChromeProfile writes the profile in the JSON format of Chrome DevTools'
+// .cpuprofile files, i.e. the Profiler.Profile type of the Chrome DevTools
+// Protocol.
+func (p *CPUProfile) WriteChromeProfile(w io.Writer) error {
+	type callFrame struct {
+		FunctionName string `json:"functionName"`
+		ScriptID     string `json:"scriptId"`
+		URL          string `json:"url"`
+		LineNumber   int    `json:"lineNumber"`   // 0-based
+		ColumnNumber int    `json:"columnNumber"` // 0-based
+	}
+	type node struct {
+		ID          int       `json:"id"`
+		CallFrame   callFrame `json:"callFrame"`
+		HitCount    int       `json:"hitCount"`
+		Children    []int     `json:"children,omitempty"`
+		DeoptReason string    `json:"deoptReason,omitempty"`
+	}
+	profile := struct {
+		Nodes      []node  `json:"nodes"`
+		StartTime  int64   `json:"startTime"`
+		EndTime    int64   `json:"endTime"`
+		Samples    []int   `json:"samples"`
+		TimeDeltas []int64 `json:"timeDeltas"`
+	}{
+		Nodes:      []node{},
+		StartTime:  int64(p.StartTime / time.Microsecond),
+		EndTime:    int64(p.EndTime / time.Microsecond),
+		Samples:    p.Samples,
+		TimeDeltas: make([]int64, len(p.Timestamps)),
+	}
+	if profile.Samples == nil {
+		profile.Samples = []int{}
+	}
+	p.Walk(func(n *CPUProfileNode) {
+		children := make([]int, len(n.Children))
+		for i, child := range n.Children {
+			children[i] = child.ID
+		}
+		profile.Nodes = append(profile.Nodes, node{
+			ID: n.ID,
+			CallFrame: callFrame{
+				FunctionName: n.FunctionName,
+				ScriptID:     strconv.Itoa(n.ScriptID),
+				URL:          n.ScriptName,
+				LineNumber:   n.LineNumber - 1,
+				ColumnNumber: n.ColumnNumber - 1,
+			},
+			HitCount:    n.HitCount,
+			Children:    children,
+			DeoptReason: n.BailoutReason,
+		})
+	})
+	last := p.StartTime
+	for i, t := range p.Timestamps {
+		profile.TimeDeltas[i] = int64((t - last) / time.Microsecond)
+		last = t
+	}
+	return json.NewEncoder(w).Encode(profile)
+}
+
+// pprofSamplingPeriod is V8's default sampling interval.
+const pprofSamplingPeriod = time.Millisecond
+
+// WritePprof writes the profile in the gzipped protocol buffer format of Go's
+// pprof, so that it can be analyzed with `go tool pprof` like Go CPU profiles.
+// Each function is identified by its name, script and line.
+func (p *CPUProfile) WritePprof(w io.Writer) error {
+	var b protoBuffer
+	index := map[string]int{}
+	var stringTable []string
+	str := func(s string) int {
+		if i, ok := index[s]; ok {
+			return i
+		}
+		index[s] = len(stringTable)
+		stringTable = append(stringTable, s)
+		return len(stringTable) - 1
+	}
+	str("")
+
+	// sample_type
+	for _, vt := range [][2]string{{"samples", "count"}, {"cpu", "nanoseconds"}} {
+		var m protoBuffer
+		m.int(1, int64(str(vt[0])))
+		m.int(2, int64(str(vt[1])))
+		b.message(1, &m)
+	}
+
+	// Every node is a location. Its call stack goes up to, but excludes, the
+	// root.
+	parents := map[*CPUProfileNode]*CPUProfileNode{}
+	functions := map[[3]interface{}]int{}
+	p.Walk(func(n *CPUProfileNode) {
+		for _, child := range n.Children {
+			parents[child] = n
+		}
+	})
+	p.Walk(func(n *CPUProfileNode) {
+		if n == p.Root {
+			return
+		}
+		key := [3]interface{}{n.FunctionName, n.ScriptName, n.LineNumber}
+		fid, ok := functions[key]
+		if !ok {
+			fid = len(functions) + 1
+			functions[key] = fid
+			name := n.FunctionName
+			if name == "" {
+				name = "(anonymous)"
+			}
+			var f protoBuffer
+			f.int(1, int64(fid))
+			f.int(2, int64(str(name)))
+			f.int(3, int64(str(name)))
+			f.int(4, int64(str(n.ScriptName)))
+			f.int(5, int64(n.LineNumber))
+			b.message(5, &f)
+		}
+
+		var line protoBuffer
+		line.int(1, int64(fid))
+		line.int(2, int64(n.LineNumber))
+		var loc protoBuffer
+		loc.int(1, int64(n.ID))
+		loc.message(4, &line)
+		b.message(4, &loc)
+
+		if n.HitCount > 0 {
+			var stack []int64
+			for s := n; s != nil && s != p.Root; s = parents[s] {
+				stack = append(stack, int64(s.ID))
+			}
+			var sample protoBuffer
+			sample.packed(1, stack)
+			sample.packed(2, []int64{int64(n.HitCount), int64(n.HitCount) * int64(pprofSamplingPeriod)})
+			b.message(2, &sample)
+		}
+	})
+
+	var periodType protoBuffer
+	periodType.int(1, int64(str("cpu")))
+	periodType.int(2, int64(str("nanoseconds")))
+
+	for _, s := range stringTable {
+		b.string(6, s)
+	}
+	b.int(10, int64(p.EndTime-p.StartTime)) // duration_nanos
+	b.message(11, &periodType)
+	b.int(12, int64(pprofSamplingPeriod))
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.data); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer encodes a protocol buffer message, just enough for WritePprof.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) int(field int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field)<<3 | 0) // varint
+	b.varint(uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.varint(uint64(field)<<3 | 2) // length-delimited
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
+
+func (b *protoBuffer) message(field int, m *protoBuffer) {
+	b.bytes(field, m.data)
+}
+
+func (b *protoBuffer) packed(field int, xs []int64) {
+	var p protoBuffer
+	for _, x := range xs {
+		p.varint(uint64(x))
+	}
+	b.bytes(field, p.data)
+}
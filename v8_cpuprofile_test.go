@@ -0,0 +1,165 @@
+package v8
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"runtime"
+	"testing"
+)
+
+func TestCPUProfile(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+	if _, err := ctx.Eval(`
+		function fib(n) { return n < 2 ? n : fib(n-1) + fib(n-2); }
+		function render() { return fib(27); }
+	`, "render.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := iso.StopCPUProfile("missing"); p != nil {
+		t.Errorf("Expected no profile, got %#v", p)
+	}
+
+	if err := iso.StartCPUProfile("render"); err == nil {
+		t.Error("Expected an error outside of Do")
+	}
+
+	// V8 samples the thread that started the profile.
+	var p *CPUProfile
+	iso.Do(func() {
+		if err := iso.StartCPUProfile("render"); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := ctx.Eval(`render()`, "main.js"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p = iso.StopCPUProfile("render")
+	})
+	if p == nil {
+		t.Fatal("Expected a profile")
+	}
+
+	if p.Name != "render" || p.Root == nil || p.Root.FunctionName != "(root)" {
+		t.Fatalf("Wrong profile: %#v", p)
+	}
+	if len(p.Samples) == 0 || len(p.Samples) != len(p.Timestamps) {
+		t.Errorf("Expected samples with timestamps, got %d and %d",
+			len(p.Samples), len(p.Timestamps))
+	}
+	if p.EndTime <= p.StartTime {
+		t.Errorf("Wrong times: %v to %v", p.StartTime, p.EndTime)
+	}
+
+	var fib *CPUProfileNode
+	ids := map[int]bool{}
+	p.Walk(func(n *CPUProfileNode) {
+		ids[n.ID] = true
+		if n.FunctionName == "fib" && fib == nil {
+			fib = n
+		}
+	})
+	if fib == nil {
+		t.Fatal("Expected fib in the profile")
+	}
+	if fib.ScriptName != "render.js" || fib.LineNumber != 2 {
+		t.Errorf("Wrong node for fib: %#v", fib)
+	}
+	for _, id := range p.Samples {
+		if !ids[id] {
+			t.Errorf("Sample of unknown node %d", id)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteChromeProfile(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var chrome struct {
+		Nodes []struct {
+			ID        int `json:"id"`
+			CallFrame struct {
+				FunctionName string `json:"functionName"`
+				URL          string `json:"url"`
+				LineNumber   int    `json:"lineNumber"`
+			} `json:"callFrame"`
+		} `json:"nodes"`
+		Samples    []int   `json:"samples"`
+		TimeDeltas []int64 `json:"timeDeltas"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &chrome); err != nil {
+		t.Fatal(err)
+	}
+	if len(chrome.Nodes) != len(ids) || len(chrome.Samples) != len(p.Samples) ||
+		len(chrome.TimeDeltas) != len(p.Samples) {
+		t.Errorf("Wrong .cpuprofile: %s", buf.String())
+	}
+	for _, n := range chrome.Nodes {
+		if n.ID == fib.ID && (n.CallFrame.URL != "render.js" || n.CallFrame.LineNumber != 1) {
+			t.Errorf("Wrong .cpuprofile node for fib: %#v", n)
+		}
+	}
+
+	buf.Reset()
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"fib", "render.js", "cpu", "nanoseconds"} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("Expected %q in the pprof profile", s)
+		}
+	}
+}
+
+func TestCPUProfileOtherThread(t *testing.T) {
+	t.Parallel()
+	// Keep other goroutines off this goroutine's thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	iso := NewIsolate()
+	iso.NewContext()
+	iso.Do(func() {
+		if err := iso.StartCPUProfile("first"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	startElsewhere := func() error {
+		errs := make(chan error)
+		go func() {
+			var err error
+			iso.Do(func() {
+				if err = iso.StartCPUProfile("second"); err == nil {
+					iso.StopCPUProfile("second")
+				}
+			})
+			errs <- err
+		}()
+		return <-errs
+	}
+
+	if err := startElsewhere(); err == nil {
+		t.Error("Expected an error while another thread is sampled")
+	}
+	if p := iso.StopCPUProfile("first"); p == nil {
+		t.Fatal("Expected the first profile")
+	}
+	// Once no profiles are recorded, any thread may start one.
+	if err := startElsewhere(); err != nil {
+		t.Error(err)
+	}
+}
@@ -39,9 +39,10 @@ var timeType = reflect.TypeOf(time.Time{})
 //   * slices of convertible types
 //   * pointers to any convertible field
 //   * v8.Callback function (automatically bind'd)
+//   * other functions (automatically bind'd, see BindFunc)
 //   * *v8.Value (returned as-is)
 //
-// Any nil pointers are converted to undefined in JS.
+// Any nil pointers or functions are converted to undefined in JS.
 //
 // Values for elements in maps, structs, and slices may be any of the above
 // types.
@@ -133,11 +134,15 @@ func (ctx *Context) createWithTags(val reflect.Value, tags []string) (v *Value,
 	case reflect.Chan:
 		return nil, false, fmt.Errorf("Chan not supported: %#v", val.Interface())
 	case reflect.Func:
-		if val.Type().ConvertibleTo(callbackType) {
-			name := path.Base(runtime.FuncForPC(val.Pointer()).Name())
-			return ctx.Bind(name, val.Convert(callbackType).Interface().(Callback)), true, nil
+		if val.IsNil() {
+			return ctx.create(reflect.Value{})
 		}
-		return nil, false, fmt.Errorf("Func not supported: %#v", val.Interface())
+		cb, err := funcToCallback(val)
+		if err != nil {
+			return nil, false, err
+		}
+		name := path.Base(runtime.FuncForPC(val.Pointer()).Name())
+		return ctx.Bind(name, cb), true, nil
 	case reflect.Interface, reflect.Ptr:
 		return ctx.create(val.Elem())
 	case reflect.Map:
@@ -164,14 +169,7 @@ func (ctx *Context) createWithTags(val reflect.Value, tags []string) (v *Value,
 		ob := ctx.createVal(C.ImmediateValue{Type: C.tOBJECT}, mask(KindObject))
 		return ob, true, ctx.writeStructFields(ob, val)
 	case reflect.Array, reflect.Slice:
-		arrayBuffer := false
-		for _, tag := range tags {
-			if strings.TrimSpace(tag) == "arraybuffer" {
-				arrayBuffer = true
-			}
-		}
-
-		if arrayBuffer && val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Uint8 {
+		if hasTag(tags, "arraybuffer") && val.Kind() == reflect.Slice && val.Type().Elem().Kind() == reflect.Uint8 {
 			// Special case for byte array -> arraybuffer
 			bytes := val.Bytes()
 			var ptr *C.char
@@ -0,0 +1,149 @@
+package v8
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// JSError is the error returned when javascript throws an exception, for
+// example from Eval, Call, New, Get, or Set. Use errors.As to access it:
+//
+//     var jsErr *v8.JSError
+//     if errors.As(err, &jsErr) {
+//         fmt.Println(jsErr.Name, jsErr.Message, jsErr.Location.Line)
+//     }
+//
+// Error() returns the full report including the source line and stack trace.
+type JSError struct {
+	// Name is the name of the error, e.g. "TypeError" or "RangeError". It is
+	// empty if the thrown value does not have a string name property, e.g. if
+	// a string was thrown.
+	Name string
+	// Message is the message of the error, or the string representation of the
+	// thrown value if it doesn't have a string message property.
+	Message string
+	// Value is the thrown value itself. It may be used to retrieve any custom
+	// properties of the thrown object. Value is nil if the execution was
+	// terminated rather than throwing, or if the exception was thrown while
+	// creating a snapshot.
+	Value *Value
+	// SourceLine is the line of source code where the exception was thrown.
+	SourceLine string
+	// Location is where the exception was thrown. Funcname is always empty.
+	Location Loc
+	// Stack is the javascript call stack at the point where the exception was
+	// thrown, innermost frame first.
+	Stack []Loc
+
+	report string
+}
+
+func (e *JSError) Error() string { return e.report }
+
+func (ctx *Context) convertError(error_msg C.Error, exception *C.Exception) error {
+	err := ctx.iso.convertErrorMsg(error_msg)
+	if exception == nil {
+		return err
+	}
+	defer C.free(unsafe.Pointer(exception))
+
+	jsErr := takeException(err, exception)
+	jsErr.Value = ctx.newValue(exception.Value, exception.Kinds)
+
+	if jsErr.Value == nil && C.v8_Isolate_TakeHeapLimitExceeded(ctx.iso.ptr) != 0 {
+		return ErrHeapLimitExceeded
+	}
+	return jsErr
+}
+
+// takeException converts the exception, except for its Value, into a JSError
+// with the error report err. The exception's strings are freed, but not the
+// exception itself.
+func takeException(err error, exception *C.Exception) *JSError {
+	jsErr := &JSError{
+		Name:       takeString(exception.Name),
+		Message:    takeString(exception.Message),
+		SourceLine: takeString(exception.SourceLine),
+		Location:   takeLoc(exception.Location),
+		Stack:      takeFrames(exception.Frames, exception.NumFrames),
+	}
+	if err != nil {
+		jsErr.report = err.Error()
+	} else {
+		jsErr.report = "Uncaught exception: " + jsErr.Message
+	}
+	return jsErr
+}
+
+// SyntaxError is returned by Isolate.CheckSyntax for code that cannot be
+// compiled.
+type SyntaxError struct {
+	// Name is the name of the error, usually "SyntaxError".
+	Name string
+	// Message describes the error, e.g. "Unexpected token )".
+	Message string
+	// SourceLine is the line of source code that contains the error.
+	SourceLine string
+	// Location is where the error is. Funcname is always empty.
+	Location Loc
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s at %s:%d:%d", e.Name, e.Message,
+		e.Location.Filename, e.Location.Line, e.Location.Column)
+}
+
+// newRejectionError creates a JSError describing the reason a promise was
+// rejected. Unlike thrown exceptions, rejections carry no location.
+func newRejectionError(reason *Value) *JSError {
+	jsErr := &JSError{Message: reason.String(), Value: reason}
+	if reason.IsKind(KindObject) {
+		if name, err := reason.Get("name"); err == nil && name.IsKind(KindString) {
+			jsErr.Name = name.String()
+		}
+		if msg, err := reason.Get("message"); err == nil && msg.IsKind(KindString) {
+			jsErr.Message = msg.String()
+		}
+	}
+	jsErr.report = "Promise rejected: " + reason.String()
+	return jsErr
+}
+
+// takeString converts a malloc'd C string into a Go string and frees it.
+func takeString(s C.String) string {
+	str := C.GoStringN(s.ptr, s.len)
+	C.free(unsafe.Pointer(s.ptr))
+	return str
+}
+
+// takeFrames converts a C array of stack frames and frees it.
+func takeFrames(ptr *C.CallerInfo, num C.int) []Loc {
+	n := int(num)
+	if n == 0 {
+		return nil
+	}
+	frames := (*[1 << 20]C.CallerInfo)(unsafe.Pointer(ptr))[:n:n]
+	stack := make([]Loc, n)
+	for i := range frames {
+		stack[i] = takeLoc(frames[i])
+	}
+	C.free(unsafe.Pointer(ptr))
+	return stack
+}
+
+// takeLoc converts a C location and frees its strings.
+func takeLoc(info C.CallerInfo) Loc {
+	return Loc{
+		Funcname: takeString(info.Funcname),
+		Filename: takeString(info.Filename),
+		Line:     int(info.Line),
+		Column:   int(info.Column),
+	}
+}
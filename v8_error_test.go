@@ -0,0 +1,132 @@
+package v8
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSError(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	_, err := ctx.Eval(`
+		function inner() { null.foo; }
+		function outer() { inner(); }
+		outer();
+	`, "stack.js")
+
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) {
+		t.Fatalf("Expected a *JSError, got %#v", err)
+	}
+	if jsErr.Name != "TypeError" {
+		t.Errorf("Expected TypeError, got %q", jsErr.Name)
+	}
+	if !strings.Contains(jsErr.Message, "null") {
+		t.Errorf("Expected message about null, got %q", jsErr.Message)
+	}
+	if !strings.Contains(jsErr.SourceLine, "null.foo") {
+		t.Errorf("Wrong source line: %q", jsErr.SourceLine)
+	}
+	if jsErr.Location.Filename != "stack.js" || jsErr.Location.Line != 2 {
+		t.Errorf("Wrong location: %#v", jsErr.Location)
+	}
+	if jsErr.Value == nil || !jsErr.Value.IsKind(KindNativeError) {
+		t.Errorf("Expected thrown error value, got %v", jsErr.Value)
+	}
+
+	if len(jsErr.Stack) < 3 {
+		t.Fatalf("Expected at least 3 stack frames, got %#v", jsErr.Stack)
+	}
+	expected := []Loc{
+		{Funcname: "inner", Filename: "stack.js", Line: 2},
+		{Funcname: "outer", Filename: "stack.js", Line: 3},
+	}
+	for i, exp := range expected {
+		got := jsErr.Stack[i]
+		got.Column = 0 // columns are checked below
+		if got != exp {
+			t.Errorf("Frame %d: expected %#v, got %#v", i, exp, got)
+		}
+		if jsErr.Stack[i].Column <= 0 {
+			t.Errorf("Frame %d: expected a column, got %#v", i, jsErr.Stack[i])
+		}
+	}
+}
+
+func TestJSErrorCustomProperties(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	fn, err := ctx.Eval(`(function() {
+		class ValidationError extends Error {
+			constructor(field) {
+				super("invalid " + field);
+				this.name = "ValidationError";
+				this.field = field;
+			}
+		}
+		throw new ValidationError("email");
+	})`, "custom.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fn.Call(nil)
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) {
+		t.Fatalf("Expected a *JSError, got %#v", err)
+	}
+	if jsErr.Name != "ValidationError" || jsErr.Message != "invalid email" {
+		t.Errorf("Wrong error: %q %q", jsErr.Name, jsErr.Message)
+	}
+	if field, err := jsErr.Value.Get("field"); err != nil {
+		t.Error(err)
+	} else if field.String() != "email" {
+		t.Errorf("Expected field 'email', got %q", field)
+	}
+}
+
+func TestJSErrorThrowNonError(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	_, err := ctx.Eval(`throw 'badness'`, "string.js")
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) {
+		t.Fatalf("Expected a *JSError, got %#v", err)
+	}
+	if jsErr.Name != "" || jsErr.Message != "badness" {
+		t.Errorf("Wrong error: %q %q", jsErr.Name, jsErr.Message)
+	}
+	if !jsErr.Value.IsKind(KindString) {
+		t.Errorf("Expected thrown string value, got %v", jsErr.Value.kindMask)
+	}
+}
+
+func TestJSErrorFromGetAndSet(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	ob, err := ctx.Eval(`({
+		get boom() { throw new RangeError("get") },
+		set boom(v) { throw new RangeError("set") },
+	})`, "accessors.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var jsErr *JSError
+	if _, err := ob.Get("boom"); !errors.As(err, &jsErr) {
+		t.Errorf("Expected a *JSError from Get, got %#v", err)
+	} else if jsErr.Name != "RangeError" || jsErr.Message != "get" {
+		t.Errorf("Wrong error from Get: %q %q", jsErr.Name, jsErr.Message)
+	}
+
+	if err := ob.Set("boom", ob); !errors.As(err, &jsErr) {
+		t.Errorf("Expected a *JSError from Set, got %#v", err)
+	} else if jsErr.Name != "RangeError" || jsErr.Message != "set" {
+		t.Errorf("Wrong error from Set: %q %q", jsErr.Name, jsErr.Message)
+	}
+}
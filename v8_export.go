@@ -0,0 +1,222 @@
+package v8
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// Undefined is the Go representation of the javascript undefined value as
+// returned by Export. It allows distinguishing undefined from null, which is
+// exported as nil.
+type Undefined struct{}
+
+// Export maps this JavaScript value into a corresponding Go value. It is the
+// inverse of Context.Create.
+//
+// Export maps the following kinds of values:
+//   * undefined --> v8.Undefined{}
+//   * null --> nil
+//   * booleans (and Boolean objects) --> bool
+//   * numbers (and Number objects) --> float64
+//   * strings (and String objects) --> string
+//   * Date objects --> time.Time
+//   * ArrayBuffers, typed arrays, and DataViews --> []byte
+//   * arrays and arguments objects --> []interface{}
+//   * Map objects --> map[interface{}]interface{}
+//   * Set objects --> []interface{}
+//   * all other objects --> map[string]interface{}
+//
+// Only the own, enumerable properties of objects are exported, just as with
+// JSON.stringify. Values that have no Go equivalent such as functions,
+// symbols, promises, regexps, errors, and proxies are returned as the *Value
+// itself, so they may still be used from Go.
+//
+// Export fails if the value contains a circular reference or if a Map key
+// cannot be used as a Go map key.
+func (v *Value) Export() (interface{}, error) {
+	return v.export(nil)
+}
+
+func (v *Value) export(parents []*Value) (interface{}, error) {
+	switch {
+	case v.IsKind(KindUndefined):
+		return Undefined{}, nil
+	case v.IsKind(KindNull):
+		return nil, nil
+	case v.IsKind(KindBoolean):
+		return v.Bool(), nil
+	case v.IsKind(KindNumber), v.IsKind(KindNumberObject):
+		return v.Float64(), nil
+	case v.IsKind(KindString), v.IsKind(KindStringObject):
+		return v.String(), nil
+	case v.IsKind(KindBooleanObject):
+		// Any object is truthy, so we need the wrapped primitive instead.
+		valueOf, err := v.Get("valueOf")
+		if err != nil {
+			return nil, err
+		}
+		b, err := valueOf.Call(v)
+		if err != nil {
+			return nil, err
+		}
+		return b.Bool(), nil
+	case v.IsKind(KindDate):
+		return v.Date()
+	case v.IsKind(KindArrayBuffer), v.IsKind(KindArrayBufferView):
+		data := v.Bytes()
+		if data == nil {
+			data = []byte{}
+		}
+		return data, nil
+	case v.IsKind(KindFunction), v.IsKind(KindSymbol), v.IsKind(KindPromise),
+		v.IsKind(KindRegExp), v.IsKind(KindNativeError), v.IsKind(KindProxy),
+		v.IsKind(KindWeakMap), v.IsKind(KindWeakSet), v.IsKind(KindMapIterator),
+		v.IsKind(KindSetIterator), v.IsKind(KindGeneratorObject),
+		v.IsKind(KindSharedArrayBuffer), v.IsKind(KindExternal),
+		v.IsKind(KindWebAssemblyCompiledModule):
+		return v, nil
+	}
+
+	if !v.IsKind(KindObject) {
+		return nil, fmt.Errorf("cannot export value of kind %v", v.kindMask)
+	}
+
+	for _, p := range parents {
+		if v.strictEquals(p) {
+			return nil, errors.New("circular reference")
+		}
+	}
+	parents = append(parents, v)
+
+	switch {
+	case v.IsKind(KindArray), v.IsKind(KindArgumentsObject):
+		return v.exportList(parents)
+	case v.IsKind(KindMap):
+		return v.exportMap(parents)
+	case v.IsKind(KindSet):
+		entries, err := v.asArray()
+		if err != nil {
+			return nil, err
+		}
+		defer entries.release()
+		return entries.exportList(parents)
+	}
+	return v.exportObject(parents)
+}
+
+func (v *Value) exportList(parents []*Value) ([]interface{}, error) {
+	length, err := v.Get("length")
+	if err != nil {
+		return nil, err
+	}
+	n := int(length.Int64())
+	length.release()
+
+	res := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		elem, err := v.GetIndex(i)
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %v", i, err)
+		}
+		if res[i], err = elem.exportAndRelease(parents); err != nil {
+			return nil, fmt.Errorf("index %d: %v", i, err)
+		}
+	}
+	return res, nil
+}
+
+func (v *Value) exportMap(parents []*Value) (map[interface{}]interface{}, error) {
+	entries, err := v.asArray()
+	if err != nil {
+		return nil, err
+	}
+	defer entries.release()
+
+	flat, err := entries.exportList(parents)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[interface{}]interface{}, len(flat)/2)
+	for i := 0; i+1 < len(flat); i += 2 {
+		key := flat[i]
+		if key != nil && !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("map key %d: %T cannot be used as a Go map key", i/2, key)
+		}
+		res[key] = flat[i+1]
+	}
+	return res, nil
+}
+
+func (v *Value) exportObject(parents []*Value) (map[string]interface{}, error) {
+	keys, err := v.keys()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		field, err := v.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %v", key, err)
+		}
+		if res[key], err = field.exportAndRelease(parents); err != nil {
+			return nil, fmt.Errorf("field %q: %v", key, err)
+		}
+	}
+	return res, nil
+}
+
+// exportAndRelease exports the value and then releases it unless the value
+// itself was returned.
+func (v *Value) exportAndRelease(parents []*Value) (interface{}, error) {
+	res, err := v.export(parents)
+	if res != v {
+		v.release()
+	}
+	return res, err
+}
+
+// keys returns the names of the object's own enumerable properties.
+func (v *Value) keys() ([]string, error) {
+	arr, err := v.ctx.split(C.v8_Value_Keys(v.ctx.ptr, v.ptr))
+	if err != nil {
+		return nil, err
+	}
+	defer arr.release()
+
+	length, err := arr.Get("length")
+	if err != nil {
+		return nil, err
+	}
+	n := int(length.Int64())
+	length.release()
+
+	keys := make([]string, n)
+	for i := range keys {
+		key, err := arr.GetIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key.String()
+		key.release()
+	}
+	return keys, nil
+}
+
+// asArray returns the contents of a Map or Set as an array. Maps are flattened
+// into [key0, value0, key1, value1, ...].
+func (v *Value) asArray() (*Value, error) {
+	return v.ctx.split(C.v8_Value_AsArray(v.ctx.ptr, v.ptr))
+}
+
+// strictEquals compares the values using javascript's === operator.
+func (v *Value) strictEquals(other *Value) bool {
+	return C.v8_Value_StrictEquals(v.ctx.ptr, v.ptr, other.ptr) == 1
+}
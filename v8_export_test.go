@@ -0,0 +1,145 @@
+package v8
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportSimple(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	var testcases = []struct {
+		js       string
+		expected interface{}
+	}{
+		{`undefined`, Undefined{}},
+		{`null`, nil},
+		{`true`, true},
+		{`new Boolean(false)`, false},
+		{`3.5`, 3.5},
+		{`new Number(7)`, 7.0},
+		{`"asdf"`, "asdf"},
+		{`new String("xyz")`, "xyz"},
+		{`[1, "two", null, undefined]`, []interface{}{1.0, "two", nil, Undefined{}}},
+		{`({a: 1, b: {c: [true]}})`, map[string]interface{}{
+			"a": 1.0,
+			"b": map[string]interface{}{"c": []interface{}{true}},
+		}},
+		{`new Uint8Array([1,2,3,4]).buffer`, []byte{1, 2, 3, 4}},
+		{`new Uint8Array([1,2,3,4]).subarray(1, 3)`, []byte{2, 3}},
+		{`new ArrayBuffer(0)`, []byte{}},
+		{`new Map([["a", 1], [2, "b"]])`, map[interface{}]interface{}{"a": 1.0, 2.0: "b"}},
+		{`new Set(["a", 1])`, []interface{}{"a", 1.0}},
+		{`(function(){ return arguments })(1, 2)`, []interface{}{1.0, 2.0}},
+	}
+
+	for i, test := range testcases {
+		val, err := ctx.Eval(test.js, "export.js")
+		if err != nil {
+			t.Errorf("%d %#q: Failed to run js: %v", i, test.js, err)
+			continue
+		}
+		res, err := val.Export()
+		if err != nil {
+			t.Errorf("%d %#q: Failed to export: %v", i, test.js, err)
+		} else if !reflect.DeepEqual(res, test.expected) {
+			t.Errorf("%d %#q: Wrong export:\nExp: %#v\nGot: %#v", i, test.js, test.expected, res)
+		}
+	}
+}
+
+func TestExportDate(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	val, err := ctx.Eval(`({when: new Date("2018-05-08T08:16:46.918Z")})`, "date.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := val.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm, ok := res.(map[string]interface{})["when"].(time.Time)
+	if !ok {
+		t.Fatalf("Expected a time.Time, got %#v", res)
+	} else if tm.UnixNano() != 1525767406918*1e6 {
+		t.Errorf("Wrong date: %q", tm)
+	}
+}
+
+func TestExportKeepsFunctionsAsValues(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	val, err := ctx.Eval(`({add: (a, b) => a + b})`, "fn.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := val.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	add, ok := res.(map[string]interface{})["add"].(*Value)
+	if !ok {
+		t.Fatalf("Expected function to be exported as *Value, got %#v", res)
+	}
+	a, _ := ctx.Create(3)
+	b, _ := ctx.Create(4)
+	if sum, err := add.Call(nil, a, b); err != nil {
+		t.Fatal(err)
+	} else if sum.Int64() != 7 {
+		t.Errorf("Expected 7, got %v", sum)
+	}
+}
+
+func TestExportCircularReference(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	circ, err := ctx.Eval("var test = {a: {}}; test.a.b = test; test", "circular.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := circ.Export()
+	if err == nil {
+		t.Fatalf("Expected error exporting circular ref, but got: %#v", res)
+	} else if !strings.Contains(err.Error(), "circular") {
+		t.Errorf("Expected a circular reference error, but got: %v", err)
+	}
+
+	// Shared, non-circular references are fine.
+	shared, err := ctx.Eval("var x = {n: 1}; [x, x]", "shared.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shared.Export(); err != nil {
+		t.Errorf("Expected shared references to export, but got: %v", err)
+	}
+}
+
+func TestExportCreateRoundtrip(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	orig := map[string]interface{}{
+		"num":  3.7,
+		"str":  "simple string",
+		"bool": true,
+		"list": []interface{}{1.0, "x"},
+		"sub":  map[string]interface{}{"a": "b"},
+	}
+	val, err := ctx.Create(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := val.Export()
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res, orig) {
+		t.Errorf("Roundtrip failed:\nExp: %#v\nGot: %#v", orig, res)
+	}
+}
@@ -0,0 +1,232 @@
+package v8
+
+import (
+	"io"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// HeapSpaceStatistics represent v8::HeapSpaceStatistics which are statistics
+// about the memory usage of one space of the heap.
+type HeapSpaceStatistics struct {
+	// SpaceName is V8's name of the space, e.g. "new_space", "old_space",
+	// "code_space", "map_space" or "large_object_space".
+	SpaceName          string
+	SpaceSize          uint64
+	SpaceUsedSize      uint64
+	SpaceAvailableSize uint64
+	PhysicalSpaceSize  uint64
+}
+
+// GetHeapSpaceStatistics gets statistics about the memory usage of each space
+// of the heap.
+func (i *Isolate) GetHeapSpaceStatistics() []HeapSpaceStatistics {
+	list := C.v8_Isolate_GetHeapSpaceStatistics(i.ptr)
+	if list.spaces == nil {
+		return nil
+	}
+	defer C.free(unsafe.Pointer(list.spaces))
+
+	n := int(list.num_spaces)
+	spaces := (*[1 << 20]C.HeapSpaceStatistics)(unsafe.Pointer(list.spaces))[:n:n]
+	res := make([]HeapSpaceStatistics, n)
+	for j, ss := range spaces {
+		res[j] = HeapSpaceStatistics{
+			SpaceName:          takeString(ss.space_name),
+			SpaceSize:          uint64(ss.space_size),
+			SpaceUsedSize:      uint64(ss.space_used_size),
+			SpaceAvailableSize: uint64(ss.space_available_size),
+			PhysicalSpaceSize:  uint64(ss.physical_space_size),
+		}
+	}
+	return res
+}
+
+// HeapCodeStatistics represent v8::HeapCodeStatistics which are statistics
+// about the memory used by compiled code.
+type HeapCodeStatistics struct {
+	CodeAndMetadataSize     uint64
+	BytecodeAndMetadataSize uint64
+}
+
+// GetHeapCodeStatistics gets statistics about the memory used by compiled
+// code and bytecode.
+func (i *Isolate) GetHeapCodeStatistics() HeapCodeStatistics {
+	cs := C.v8_Isolate_GetHeapCodeStatistics(i.ptr)
+	return HeapCodeStatistics{
+		CodeAndMetadataSize:     uint64(cs.code_and_metadata_size),
+		BytecodeAndMetadataSize: uint64(cs.bytecode_and_metadata_size),
+	}
+}
+
+// GCType is a type of garbage collection.
+type GCType uint8
+
+// NOTE! These values must exactly match the values of GCType in
+// v8_c_bridge.h.
+const (
+	// GCScavenge collects the young generation.
+	GCScavenge GCType = iota
+	// GCMinorMarkCompact also collects the young generation, with a
+	// different algorithm.
+	GCMinorMarkCompact
+	// GCMarkSweepCompact collects the whole heap.
+	GCMarkSweepCompact
+	// GCIncrementalMarking is a step of marking the heap incrementally for a
+	// later GCMarkSweepCompact.
+	GCIncrementalMarking
+	// GCProcessWeakCallbacks calls the callbacks of weak references.
+	GCProcessWeakCallbacks
+)
+
+func (t GCType) String() string {
+	switch t {
+	case GCScavenge:
+		return "scavenge"
+	case GCMinorMarkCompact:
+		return "minor-mark-compact"
+	case GCMarkSweepCompact:
+		return "mark-sweep-compact"
+	case GCIncrementalMarking:
+		return "incremental-marking"
+	case GCProcessWeakCallbacks:
+		return "process-weak-callbacks"
+	}
+	return "unknown"
+}
+
+// GCEvent describes a garbage collection.
+type GCEvent struct {
+	Type GCType
+	// Forced is whether the garbage collection was forced, e.g. by
+	// SendLowMemoryNotification, rather than triggered by allocations.
+	Forced   bool
+	Duration time.Duration
+	// UsedHeapSizeBefore and UsedHeapSizeAfter are the UsedHeapSize of the
+	// HeapStatistics before and after the garbage collection.
+	UsedHeapSizeBefore uint64
+	UsedHeapSizeAfter  uint64
+	// FreedBytes is how much the used size of the heap shrank, or 0 if it
+	// didn't.
+	FreedBytes uint64
+}
+
+var (
+	gcCallbacksMutex  sync.Mutex
+	gcCallbacks       = map[int][]func(GCEvent){}
+	nextGCCallbacksId int
+)
+
+// OnGC makes the Isolate call f after every garbage collection. f is called
+// while the garbage collector holds the Isolate, so it must be quick and must
+// not use the Isolate or its Contexts; e.g. it may update metrics.
+func (i *Isolate) OnGC(f func(GCEvent)) {
+	gcCallbacksMutex.Lock()
+	first := i.gcCallbacksId == 0
+	if first {
+		nextGCCallbacksId++
+		i.gcCallbacksId = nextGCCallbacksId
+	}
+	id := i.gcCallbacksId
+	gcCallbacks[id] = append(gcCallbacks[id], f)
+	gcCallbacksMutex.Unlock()
+
+	// Garbage collections call go_gc_handler with the isolate locked, so the
+	// isolate must not be locked while holding gcCallbacksMutex.
+	if first {
+		C.v8_Isolate_AddGCCallbacks(i.ptr, C.int(id))
+	}
+}
+
+// releaseGCCallbacks deletes the callbacks added by OnGC.
+func (i *Isolate) releaseGCCallbacks() {
+	gcCallbacksMutex.Lock()
+	delete(gcCallbacks, i.gcCallbacksId)
+	i.gcCallbacksId = 0
+	gcCallbacksMutex.Unlock()
+}
+
+//export go_gc_handler
+func go_gc_handler(id C.int, event C.GCEvent) {
+	gcCallbacksMutex.Lock()
+	fs := gcCallbacks[int(id)]
+	gcCallbacksMutex.Unlock()
+
+	e := GCEvent{
+		Type:               GCType(event._type),
+		Forced:             event.forced != 0,
+		Duration:           time.Duration(float64(event.duration) * float64(time.Second)),
+		UsedHeapSizeBefore: uint64(event.used_heap_size_before),
+		UsedHeapSizeAfter:  uint64(event.used_heap_size_after),
+	}
+	if e.UsedHeapSizeBefore > e.UsedHeapSizeAfter {
+		e.FreedBytes = e.UsedHeapSizeBefore - e.UsedHeapSizeAfter
+	}
+
+	// Panics must not unwind through the garbage collector, and there's no
+	// caller to report them to. A panic doesn't keep the other callbacks from
+	// being called.
+	for _, f := range fs {
+		func() {
+			defer func() { recover() }()
+			f(e)
+		}()
+	}
+}
+
+// heapSnapshotWriter is where a heap snapshot is written to.
+type heapSnapshotWriter struct {
+	w   io.Writer
+	err error
+}
+
+var (
+	heapSnapshotsMutex sync.Mutex
+	heapSnapshots      = map[int]*heapSnapshotWriter{}
+	nextHeapSnapshotId int
+)
+
+// WriteHeapSnapshot takes a snapshot of the Isolate's heap and writes it to w
+// in the JSON format of Chrome DevTools' .heapsnapshot files, which show what
+// objects the heap contains and what retains them. The JSON is written in
+// chunks as V8 serializes it rather than buffered as a whole. Taking the
+// snapshot collects garbage first and blocks the Isolate until it's written.
+func (i *Isolate) WriteHeapSnapshot(w io.Writer) error {
+	hw := &heapSnapshotWriter{w: w}
+	heapSnapshotsMutex.Lock()
+	nextHeapSnapshotId++
+	id := nextHeapSnapshotId
+	heapSnapshots[id] = hw
+	heapSnapshotsMutex.Unlock()
+
+	C.v8_Isolate_WriteHeapSnapshot(i.ptr, C.int(id))
+
+	heapSnapshotsMutex.Lock()
+	delete(heapSnapshots, id)
+	heapSnapshotsMutex.Unlock()
+	return hw.err
+}
+
+//export go_heap_snapshot_write
+func go_heap_snapshot_write(id C.int, data *C.char, size C.int) C.int {
+	heapSnapshotsMutex.Lock()
+	hw := heapSnapshots[int(id)]
+	heapSnapshotsMutex.Unlock()
+	if hw == nil {
+		return 0
+	}
+	// Writers must not retain the chunk, so it doesn't need to be copied.
+	chunk := (*[1 << 30]byte)(unsafe.Pointer(data))[:size:size]
+	if _, hw.err = hw.w.Write(chunk); hw.err != nil {
+		return 0 // abort
+	}
+	return 1
+}
@@ -0,0 +1,145 @@
+package v8
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestHeapSpaceAndCodeStatistics(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+	if _, err := ctx.Eval(`function f() { return 1; } f();`, "f.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	spaces := iso.GetHeapSpaceStatistics()
+	var used uint64
+	names := map[string]bool{}
+	for _, s := range spaces {
+		names[s.SpaceName] = true
+		used += s.SpaceUsedSize
+		if s.SpaceUsedSize > s.SpaceSize {
+			t.Errorf("Space %q uses more than its size: %#v", s.SpaceName, s)
+		}
+	}
+	for _, name := range []string{"new_space", "old_space", "code_space", "large_object_space"} {
+		if !names[name] {
+			t.Errorf("Expected %q in %#v", name, spaces)
+		}
+	}
+	if total := iso.GetHeapStatistics().UsedHeapSize; used == 0 || used > total {
+		t.Errorf("Expected the spaces to add up to about %d, got %d", total, used)
+	}
+
+	if cs := iso.GetHeapCodeStatistics(); cs.CodeAndMetadataSize == 0 {
+		t.Errorf("Expected code: %#v", cs)
+	}
+}
+
+func TestOnGC(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+	var events, others []GCEvent
+	iso.OnGC(func(e GCEvent) { events = append(events, e) })
+	iso.OnGC(func(e GCEvent) { panic("oops") })
+	iso.OnGC(func(e GCEvent) { others = append(others, e) })
+
+	if _, err := ctx.Eval(`var garbage = []; for (var i = 0; i < 1e5; i++) garbage.push({i: i}); garbage = null;`, "gc.js"); err != nil {
+		t.Fatal(err)
+	}
+	before, n := iso.GetHeapStatistics().UsedHeapSize, len(events)
+	iso.SendLowMemoryNotification()
+	after := iso.GetHeapStatistics().UsedHeapSize
+
+	// The panic doesn't keep the last callback from being called.
+	if len(events) == n || len(events) != len(others) {
+		t.Fatalf("Expected events for both callbacks, got %d and %d", len(events), len(others))
+	}
+	freed := false
+	for _, e := range events {
+		if e.Duration < 0 || e.Type.String() == "unknown" {
+			t.Errorf("Wrong event: %#v", e)
+		}
+		// The garbage outlived the young generation.
+		freed = freed || (e.Type == GCMarkSweepCompact && e.Forced && e.FreedBytes > 1e6)
+	}
+	if !freed {
+		t.Errorf("Expected a forced full collection to free the garbage: %#v", events)
+	}
+	// The notification's events agree with the heap statistics around it.
+	first, last := events[n], events[len(events)-1]
+	if first.UsedHeapSizeBefore != before || last.UsedHeapSizeAfter != after {
+		t.Errorf("Expected the heap to go from %d to %d bytes, got %#v and %#v", before, after, first, last)
+	}
+}
+
+func TestWriteHeapSnapshot(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+	if _, err := ctx.Eval(`
+		function LeakyCache() { this.entries = []; }
+		var cache = new LeakyCache();
+		for (var i = 0; i < 100; i++) cache.entries.push({id: i});
+	`, "leak.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := iso.WriteHeapSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var snapshot struct {
+		Snapshot struct {
+			Meta struct {
+				NodeFields []string `json:"node_fields"`
+			} `json:"meta"`
+			NodeCount int `json:"node_count"`
+		} `json:"snapshot"`
+		Nodes   []int    `json:"nodes"`
+		Edges   []int    `json:"edges"`
+		Strings []string `json:"strings"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if n := snapshot.Snapshot.NodeCount; n == 0 ||
+		len(snapshot.Nodes) != n*len(snapshot.Snapshot.Meta.NodeFields) {
+		t.Errorf("Wrong nodes: %d nodes, %d values", n, len(snapshot.Nodes))
+	}
+	found := false
+	for _, s := range snapshot.Strings {
+		found = found || s == "LeakyCache"
+	}
+	if !found {
+		t.Errorf("Expected LeakyCache in the snapshot's strings")
+	}
+}
+
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.n++
+	return 0, errors.New("disk full")
+}
+
+func TestWriteHeapSnapshotError(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	iso.NewContext()
+	w := &failingWriter{}
+	if err := iso.WriteHeapSnapshot(w); err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected the writer's error, got %v", err)
+	}
+	if w.n != 1 {
+		t.Errorf("Expected serialization to stop after the error, got %d writes", w.n)
+	}
+}
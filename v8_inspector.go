@@ -0,0 +1,254 @@
+package v8
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// InspectorHandler receives the messages and events of an Inspector.
+type InspectorHandler interface {
+	// Send is called with every Chrome DevTools Protocol response and
+	// notification for the debugger. It is called on the goroutine that runs
+	// the javascript, so it must not block for long.
+	Send(msg string)
+	// RunIfWaitingForDebugger is called when the debugger asks to start
+	// running the javascript, i.e. it sent Runtime.runIfWaitingForDebugger.
+	RunIfWaitingForDebugger()
+}
+
+// Inspector attaches V8's inspector to an Isolate so that a debugger, e.g.
+// Chrome DevTools, can debug the javascript of all of its Contexts with the
+// Chrome DevTools Protocol: set breakpoints, step through the code, inspect scopes, see the
+// output of V8's built-in console, etc. The Inspector only exchanges protocol
+// messages; see the inspector package for a server that DevTools can connect
+// to.
+//
+// When the javascript pauses, e.g. at a breakpoint, the Eval or Call that runs
+// it blocks while the Inspector dispatches the debugger's messages, until the
+// debugger resumes the javascript.
+type Inspector struct {
+	iso     *Isolate
+	ptr     C.InspectorPtr
+	id      int
+	handler InspectorHandler
+
+	mu       sync.Mutex
+	queue    []string      // messages to dispatch
+	incoming chan struct{} // signals new messages to the message loop on pause
+	pending  chan struct{} // signals new messages to the dispatch loop
+	quit     bool          // whether the message loop on pause should return
+	closed   chan struct{}
+	once     sync.Once
+}
+
+var (
+	inspectorsMutex sync.Mutex
+	inspectors      = map[int]*Inspector{}
+	nextInspectorId int
+)
+
+// NewInspector attaches a new Inspector to the Context's Isolate. It must be
+// closed when the debugger disconnects. Several Inspectors may be attached at
+// the same time, but only the first one dispatches messages while the
+// javascript is paused.
+func NewInspector(ctx *Context, handler InspectorHandler) *Inspector {
+	return newInspector(ctx.iso, handler, true)
+}
+
+// newInspector attaches a new Inspector to the Isolate. Unless it's pausable,
+// it doesn't dispatch messages while the javascript is paused, so it must not
+// pause the javascript.
+func newInspector(iso *Isolate, handler InspectorHandler, pausable bool) *Inspector {
+	inspectorsMutex.Lock()
+	nextInspectorId++
+	in := &Inspector{
+		iso:      iso,
+		id:       nextInspectorId,
+		handler:  handler,
+		incoming: make(chan struct{}, 1),
+		pending:  make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	inspectors[in.id] = in
+	inspectorsMutex.Unlock()
+
+	var cpausable C.int
+	if pausable {
+		cpausable = 1
+	}
+	in.ptr = C.v8_Inspector_New(iso.ptr, C.int(in.id), cpausable)
+	go in.dispatchLoop()
+	return in
+}
+
+// Dispatch dispatches a Chrome DevTools Protocol message from the debugger. It
+// may be called from any goroutine: the message is dispatched when the
+// javascript is paused, at the next interrupt check while it's running (e.g.
+// to handle Debugger.pause), or as soon as the isolate is idle otherwise.
+func (in *Inspector) Dispatch(msg string) {
+	in.mu.Lock()
+	in.queue = append(in.queue, msg)
+	in.mu.Unlock()
+
+	signal(in.incoming)
+	signal(in.pending)
+	C.v8_Inspector_RequestDispatch(in.iso.ptr, C.int(in.id))
+}
+
+// PauseOnNextStatement makes the javascript pause before the next statement
+// that runs, e.g. to break at the start of a program once the debugger is
+// attached.
+func (in *Inspector) PauseOnNextStatement(reason string) (err error) {
+	reason_cstr := C.CString(reason)
+	defer C.free(unsafe.Pointer(reason_cstr))
+	in.iso.Do(func() {
+		if in.ptr == nil {
+			err = errors.New("Inspector is closed")
+			return
+		}
+		C.v8_Inspector_SchedulePause(in.iso.ptr, in.ptr, reason_cstr)
+	})
+	return err
+}
+
+// Close detaches the Inspector from the Context. If the javascript is paused,
+// it resumes. Close waits for any running javascript to finish.
+func (in *Inspector) Close() {
+	in.once.Do(func() {
+		close(in.closed)
+		inspectorsMutex.Lock()
+		delete(inspectors, in.id)
+		inspectorsMutex.Unlock()
+
+		// The pointer is only used with the isolate locked.
+		in.iso.Do(func() {
+			in.mu.Lock()
+			ptr := in.ptr
+			in.ptr = nil
+			in.mu.Unlock()
+			C.v8_Inspector_Release(in.iso.ptr, ptr)
+		})
+	})
+}
+
+// dispatchLoop dispatches the messages that arrive while the isolate is idle.
+func (in *Inspector) dispatchLoop() {
+	for {
+		select {
+		case <-in.pending:
+			in.iso.Do(in.dispatchQueue)
+		case <-in.closed:
+			return
+		}
+	}
+}
+
+// dispatchQueue dispatches the queued messages. It must be called with the
+// isolate locked to the current thread, which keeps Close from releasing the
+// inspector meanwhile.
+func (in *Inspector) dispatchQueue() {
+	for {
+		in.mu.Lock()
+		if len(in.queue) == 0 || in.ptr == nil {
+			in.mu.Unlock()
+			return
+		}
+		msg := in.queue[0]
+		in.queue = in.queue[1:]
+		in.mu.Unlock()
+
+		msg_cstr := C.CString(msg)
+		C.v8_Inspector_Dispatch(in.iso.ptr, in.ptr, msg_cstr)
+		C.free(unsafe.Pointer(msg_cstr))
+	}
+}
+
+// dispatchNow dispatches the message right away, waiting for the isolate if
+// it's busy. The Inspector's responses to it are sent before dispatchNow
+// returns.
+func (in *Inspector) dispatchNow(msg string) {
+	msg_cstr := C.CString(msg)
+	defer C.free(unsafe.Pointer(msg_cstr))
+	in.iso.Do(func() {
+		in.mu.Lock()
+		ptr := in.ptr
+		in.mu.Unlock()
+		if ptr != nil {
+			C.v8_Inspector_Dispatch(in.iso.ptr, ptr, msg_cstr)
+		}
+	})
+}
+
+// runMessageLoopOnPause dispatches messages while the javascript is paused
+// until the debugger resumes it or the Inspector is closed.
+func (in *Inspector) runMessageLoopOnPause() {
+	in.quit = false
+	for {
+		in.dispatchQueue()
+		if in.quit {
+			return
+		}
+		select {
+		case <-in.incoming:
+		case <-in.closed:
+			return
+		}
+	}
+}
+
+// signal notifies the channel without blocking, assuming it has a buffer.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func lookupInspector(id C.int) *Inspector {
+	inspectorsMutex.Lock()
+	defer inspectorsMutex.Unlock()
+	return inspectors[int(id)]
+}
+
+//export go_inspector_send
+func go_inspector_send(id C.int, msg C.String) {
+	if in := lookupInspector(id); in != nil {
+		in.handler.Send(C.GoStringN(msg.ptr, msg.len))
+	}
+}
+
+//export go_inspector_pause
+func go_inspector_pause(id C.int) {
+	if in := lookupInspector(id); in != nil {
+		in.runMessageLoopOnPause()
+	}
+}
+
+//export go_inspector_quit
+func go_inspector_quit(id C.int) {
+	if in := lookupInspector(id); in != nil {
+		in.quit = true
+	}
+}
+
+//export go_inspector_run
+func go_inspector_run(id C.int) {
+	if in := lookupInspector(id); in != nil {
+		in.handler.RunIfWaitingForDebugger()
+	}
+}
+
+//export go_inspector_dispatch
+func go_inspector_dispatch(id C.int) {
+	if in := lookupInspector(id); in != nil {
+		in.dispatchQueue()
+	}
+}
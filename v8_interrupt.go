@@ -0,0 +1,118 @@
+package v8
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+var (
+	interruptsMutex sync.Mutex
+	interrupts      = map[int]interrupt{}
+	nextInterruptId int
+)
+
+// interrupt is a pending RequestInterrupt. It refers to the isolate by pointer
+// so that the isolate can still be garbage collected, which deletes it.
+type interrupt struct {
+	iso C.IsolatePtr
+	f   func(*Context)
+}
+
+// RequestInterrupt makes the Isolate call f as soon as possible while
+// javascript is executing: the javascript is paused until f returns. f is
+// called with the Context whose javascript is executing, and it is called
+// when javascript runs next if none is running right now. RequestInterrupt
+// may be called from any goroutine at any time.
+//
+// If the executing Context isn't the one that the javascript was started with,
+// e.g. because a function of another Context was called, f may be called with
+// a temporary Context that is only valid until f returns. It only supports
+// CurrentStack and Terminate: in particular, Go callbacks that are bound on it
+// can't be called.
+//
+// A panic in f is logged with the log package, since it must not unwind
+// through the paused javascript and there's no caller to return it to.
+//
+// V8 doesn't allow f to run any javascript, e.g. with Eval, Call or Get, but
+// it may inspect where the javascript is with CurrentStack and stop it with
+// Terminate. For example, a watchdog may log the stack of slow javascript
+// before terminating it:
+//
+//     iso.RequestInterrupt(func(ctx *v8.Context) {
+//         log.Printf("Slow script at %v", ctx.CurrentStack())
+//     })
+func (i *Isolate) RequestInterrupt(f func(*Context)) {
+	interruptsMutex.Lock()
+	nextInterruptId++
+	id := nextInterruptId
+	interrupts[id] = interrupt{i.ptr, f}
+	interruptsMutex.Unlock()
+
+	C.v8_Isolate_RequestInterrupt(i.ptr, C.int(id))
+}
+
+// CurrentStack returns the javascript call stack that is executing in the
+// Context's Isolate, innermost frame first, or nil if no javascript is
+// executing. It is mostly useful in Go callbacks and in RequestInterrupt.
+func (ctx *Context) CurrentStack() []Loc {
+	if ctx.ptr == nil {
+		return nil
+	}
+	stack := C.v8_Context_CurrentStack(ctx.ptr)
+	return takeFrames(stack.Frames, stack.NumFrames)
+}
+
+//export go_interrupt_handler
+func go_interrupt_handler(id C.int, ctxId C.int, ctxPtr C.ContextPtr) {
+	interruptsMutex.Lock()
+	in, ok := interrupts[int(id)]
+	delete(interrupts, int(id))
+	interruptsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	contextsMutex.RLock()
+	var ctx *Context
+	if ref := contexts[int(ctxId)]; ref != nil {
+		ctx = ref.ptr
+	}
+	contextsMutex.RUnlock()
+	if ctx == nil {
+		// The javascript wasn't started with the executing Context, so f
+		// gets a temporary handle of it, without a finalizer.
+		ctx = &Context{
+			id:        int(ctxId),
+			iso:       &Isolate{ptr: in.iso, settled: make(chan struct{})},
+			ptr:       ctxPtr,
+			callbacks: map[int]callbackInfo{},
+			modules:   map[string]C.ModulePtr{},
+		}
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("Panic during interrupt: %v\n%s", v, debug.Stack())
+		}
+	}()
+	in.f(ctx)
+}
+
+// releaseInterrupts deletes the isolate's pending interrupts.
+func (i *Isolate) releaseInterrupts() {
+	interruptsMutex.Lock()
+	for id, in := range interrupts {
+		if in.iso == i.ptr {
+			delete(interrupts, id)
+		}
+	}
+	interruptsMutex.Unlock()
+}
@@ -0,0 +1,112 @@
+package v8
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestInterrupt(t *testing.T) {
+	t.Parallel()
+
+	ctx := NewIsolate().NewContext()
+	if _, err := ctx.Eval(`
+		function slow() { while (true) {} }
+		function render() { slow(); }
+	`, "template.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	stacks := make(chan []Loc, 1)
+	time.AfterFunc(10*time.Millisecond, func() {
+		ctx.iso.RequestInterrupt(func(in *Context) {
+			if in != ctx {
+				t.Errorf("Expected the executing context")
+			}
+			stacks <- in.CurrentStack()
+			in.Terminate()
+		})
+	})
+
+	if _, err := ctx.Eval(`render()`, "main.js"); err == nil {
+		t.Fatal("Expected termination")
+	}
+	stack := <-stacks
+	if len(stack) != 3 || stack[0].Funcname != "slow" || stack[1].Funcname != "render" ||
+		stack[2].Filename != "main.js" {
+		t.Errorf("Wrong stack: %#v", stack)
+	}
+
+	if stack := ctx.CurrentStack(); stack != nil {
+		t.Errorf("Expected no stack outside of javascript, got %#v", stack)
+	}
+}
+
+func TestRequestInterruptInOtherContext(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctx, other := iso.NewContext(), iso.NewContext()
+	spin, err := other.Eval(`(function spin() { while (true) {} })`, "other.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Global().Set("spin", spin)
+
+	// The executing Context is other's, whose javascript was started by ctx.
+	stacks := make(chan []Loc, 1)
+	time.AfterFunc(10*time.Millisecond, func() {
+		iso.RequestInterrupt(func(in *Context) {
+			stacks <- in.CurrentStack()
+			in.Terminate()
+		})
+	})
+	if _, err := ctx.Eval(`spin()`, "main.js"); err == nil {
+		t.Fatal("Expected termination")
+	}
+	if stack := <-stacks; len(stack) != 2 || stack[0].Funcname != "spin" || stack[1].Filename != "main.js" {
+		t.Errorf("Wrong stack: %#v", stack)
+	}
+}
+
+func TestRequestInterruptReleased(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+	iso.RequestInterrupt(func(*Context) { t.Error("Unexpected interrupt") })
+	ptr := iso.ptr
+	ctx.release()
+	iso.release()
+
+	interruptsMutex.Lock()
+	defer interruptsMutex.Unlock()
+	for _, in := range interrupts {
+		if in.iso == ptr {
+			t.Errorf("Expected the pending interrupt to be deleted")
+		}
+	}
+}
+
+func TestRequestInterruptPanic(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	ctx := NewIsolate().NewContext()
+	time.AfterFunc(10*time.Millisecond, func() {
+		ctx.iso.RequestInterrupt(func(in *Context) {
+			in.Terminate()
+			panic("watchdog bug")
+		})
+	})
+	if _, err := ctx.Eval(`while (true) {}`, "loop.js"); err == nil {
+		t.Fatal("Expected termination")
+	}
+	if !strings.Contains(logged.String(), "Panic during interrupt: watchdog bug") {
+		t.Errorf("Expected the panic to be logged, got %q", logged.String())
+	}
+}
@@ -0,0 +1,149 @@
+package v8
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unsafe"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// ModuleResolver provides the source code of the ES modules that are imported
+// by modules evaluated with Context.EvalModule.
+//
+// Resolve is called with the specifier as written in the import statement and
+// the name of the importing module. It may map them to files, embedded assets,
+// generated code or anything else.
+type ModuleResolver interface {
+	Resolve(specifier, referrer string) (source string, err error)
+}
+
+// ModuleResolverFunc is an adapter to allow the use of ordinary functions as a
+// ModuleResolver.
+type ModuleResolverFunc func(specifier, referrer string) (source string, err error)
+
+// Resolve calls f(specifier, referrer).
+func (f ModuleResolverFunc) Resolve(specifier, referrer string) (string, error) {
+	return f(specifier, referrer)
+}
+
+// SetModuleResolver sets the resolver used to load the modules imported by
+// EvalModule.
+func (ctx *Context) SetModuleResolver(r ModuleResolver) {
+	ctx.iso.Do(func() { ctx.moduleResolver = r })
+}
+
+// EvalModule runs the javascript code as an ES module, loading any imported
+// modules via the Context's ModuleResolver, and returns the module namespace
+// object, i.e. an object with a property for each export.
+//
+// Each module is only loaded and evaluated once per Context. Modules are
+// identified by name: the specifier passed to EvalModule names the evaluated
+// module, and specifiers of imports that start with "./", "../" or "/" are
+// resolved against the name of the importing module like URL paths (e.g.
+// "./util.js" imported from "lib/main.js" is "lib/util.js"). Any other
+// specifier is used as the name as-is. The name is also the module's filename
+// in stack traces and is passed to the ModuleResolver as the referrer of the
+// module's own imports.
+func (ctx *Context) EvalModule(source, specifier string) (res *Value, err error) {
+	// Loading the modules takes many calls that must see consistent modules.
+	ctx.iso.Do(func() { res, err = ctx.evalModule(source, specifier) })
+	return res, err
+}
+
+func (ctx *Context) evalModule(source, specifier string) (*Value, error) {
+	var loaded []string
+	mod, err := ctx.compileModule(source, specifier, &loaded)
+	if err != nil {
+		// Forget the modules of the broken import graph so that they may be
+		// resolved again later.
+		for _, name := range loaded {
+			delete(ctx.modules, name)
+		}
+		return nil, err
+	}
+
+	addRef(ctx)
+	defer decRef(ctx)
+	return ctx.split(C.v8_Module_Evaluate(ctx.ptr, mod))
+}
+
+// compileModule compiles the module and, recursively, all of its imports. The
+// names of any newly registered modules are appended to loaded.
+func (ctx *Context) compileModule(source, name string, loaded *[]string) (C.ModulePtr, error) {
+	source_cstr := C.CString(source)
+	defer C.free(unsafe.Pointer(source_cstr))
+	name_cstr := C.CString(name)
+	defer C.free(unsafe.Pointer(name_cstr))
+
+	ret := C.v8_Context_CompileModule(ctx.ptr, source_cstr, name_cstr)
+	if ret.Module == nil {
+		return nil, ctx.convertError(ret.error_msg, ret.exception)
+	}
+	requests := takeStrings(ret.Requests, ret.NumRequests)
+
+	// Register the module before its imports so that circular imports find it.
+	if _, exists := ctx.modules[name]; !exists {
+		ctx.modules[name] = ret.Module
+		*loaded = append(*loaded, name)
+	}
+
+	for _, specifier := range requests {
+		dep, err := ctx.importModule(specifier, name, loaded)
+		if err != nil {
+			return nil, err
+		}
+		specifier_cstr := C.CString(specifier)
+		C.v8_Module_SetDependency(ret.Module, specifier_cstr, dep)
+		C.free(unsafe.Pointer(specifier_cstr))
+	}
+	return ret.Module, nil
+}
+
+func (ctx *Context) importModule(specifier, referrer string, loaded *[]string) (C.ModulePtr, error) {
+	name := moduleName(specifier, referrer)
+	if mod, exists := ctx.modules[name]; exists {
+		return mod, nil
+	}
+	if ctx.moduleResolver == nil {
+		return nil, fmt.Errorf("Cannot import %q from %q: no ModuleResolver", specifier, referrer)
+	}
+	source, err := ctx.moduleResolver.Resolve(specifier, referrer)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot import %q from %q: %w", specifier, referrer, err)
+	}
+	return ctx.compileModule(source, name, loaded)
+}
+
+// moduleName returns the name that identifies the module imported by
+// specifier from the referrer module.
+func moduleName(specifier, referrer string) string {
+	switch {
+	case strings.HasPrefix(specifier, "/"):
+		return path.Clean(specifier)
+	case strings.HasPrefix(specifier, "./"), strings.HasPrefix(specifier, "../"):
+		return path.Join(path.Dir(referrer), specifier)
+	}
+	return specifier
+}
+
+// takeStrings converts a malloc'd array of malloc'd C strings into Go strings
+// and frees them.
+func takeStrings(ptr *C.String, n C.int) []string {
+	if n == 0 {
+		return nil
+	}
+	strs := (*[1 << 20]C.String)(unsafe.Pointer(ptr))[:n:n]
+	out := make([]string, n)
+	for i := range strs {
+		out[i] = takeString(strs[i])
+	}
+	C.free(unsafe.Pointer(ptr))
+	return out
+}
@@ -0,0 +1,130 @@
+package v8
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+type mapResolver map[string]string
+
+func (m mapResolver) Resolve(specifier, referrer string) (string, error) {
+	name := moduleName(specifier, referrer)
+	if src, ok := m[name]; ok {
+		return src, nil
+	}
+	return "", os.ErrNotExist
+}
+
+func TestEvalModule(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	var loads []string
+	files := mapResolver{
+		"lib/math.js":   `export function square(x) { return x * x; }`,
+		"lib/consts.js": `import { square } from './math.js'; export const four = square(2);`,
+		"config":        `export default { name: 'test' };`,
+	}
+	ctx.SetModuleResolver(ModuleResolverFunc(func(specifier, referrer string) (string, error) {
+		loads = append(loads, specifier+" from "+referrer)
+		return files.Resolve(specifier, referrer)
+	}))
+
+	ns, err := ctx.EvalModule(`
+		import { square } from './lib/math.js';
+		import { four } from './lib/consts.js';
+		import config from 'config';
+		export const result = square(four) + ':' + config.name;
+	`, "main.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ns.Get("result"); err != nil {
+		t.Fatal(err)
+	} else if res.String() != "16:test" {
+		t.Errorf("Wrong result: %q", res)
+	}
+
+	expected := []string{
+		"./lib/math.js from main.js",
+		"./lib/consts.js from main.js",
+		"config from main.js",
+	}
+	if strings.Join(loads, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Wrong modules loaded:\n%s", strings.Join(loads, "\n"))
+	}
+
+	// Modules are only loaded and evaluated once per context.
+	loads = nil
+	ns, err = ctx.EvalModule(`export { square as sq } from 'lib/math.js';`, "other.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loads) != 0 {
+		t.Errorf("Expected no new modules to be loaded, got %q", loads)
+	}
+	if sq, err := ns.Get("sq"); err != nil {
+		t.Fatal(err)
+	} else if !sq.IsKind(KindFunction) {
+		t.Errorf("Expected exported function, got %v", sq)
+	}
+}
+
+func TestEvalModuleCircular(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+	ctx.SetModuleResolver(mapResolver{
+		"a.js": `import { b } from './b.js'; export function a() { return 'a' + b(); }`,
+		"b.js": `import { a } from './a.js'; export function b() { return 'b'; }`,
+	})
+
+	ns, err := ctx.EvalModule(`import { a } from './a.js'; export default a();`, "main.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ns.Get("default"); err != nil {
+		t.Fatal(err)
+	} else if res.String() != "ab" {
+		t.Errorf("Wrong result: %q", res)
+	}
+}
+
+func TestEvalModuleErrors(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	if _, err := ctx.EvalModule(`import x from 'x';`, "main.js"); err == nil ||
+		!strings.Contains(err.Error(), "no ModuleResolver") {
+		t.Errorf("Expected missing resolver error, got %v", err)
+	}
+
+	ctx.SetModuleResolver(mapResolver{
+		"throws.js": `throw new Error('oops');`,
+		"bad.js":    `export default ;`,
+	})
+
+	_, err := ctx.EvalModule(`import x from './missing.js';`, "main.js")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the resolver's error, got %v", err)
+	}
+
+	var jsErr *JSError
+	_, err = ctx.EvalModule(`import './bad.js';`, "main.js")
+	if !errors.As(err, &jsErr) || jsErr.Name != "SyntaxError" {
+		t.Errorf("Expected a SyntaxError, got %v", err)
+	} else if jsErr.Location.Filename != "bad.js" {
+		t.Errorf("Expected error in bad.js, got %#v", jsErr.Location)
+	}
+
+	_, err = ctx.EvalModule(`import './throws.js';`, "main.js")
+	if !errors.As(err, &jsErr) || jsErr.Message != "oops" {
+		t.Errorf("Expected the thrown error, got %v", err)
+	}
+
+	_, err = ctx.EvalModule(`import { nope } from './throws.js';`, "main2.js")
+	if !errors.As(err, &jsErr) || jsErr.Name != "SyntaxError" {
+		t.Errorf("Expected a SyntaxError for the missing export, got %v", err)
+	}
+}
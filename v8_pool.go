@@ -0,0 +1,289 @@
+package v8
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Pool.Get after the pool was closed.
+var ErrPoolClosed = errors.New("Pool is closed")
+
+// minEvictInterval is the shortest interval at which idle isolates are checked
+// for eviction, however short IdleTimeout is.
+const minEvictInterval = time.Millisecond
+
+// PoolOptions configures a Pool. Zero values mean no limit.
+type PoolOptions struct {
+	// Isolate configures every isolate of the pool, typically with the
+	// Snapshot to create it from.
+	Isolate IsolateOptions
+	// SnapshotContext, if not empty, is the name of the snapshot context that
+	// each isolate's Context is created from. Otherwise the Context is the
+	// snapshot's default context.
+	SnapshotContext string
+
+	// MinSize isolates are created by NewPool and are never evicted for being
+	// idle.
+	MinSize int
+	// MaxSize limits the number of isolates, both idle and in use. Get waits
+	// for an isolate to be put back when there are that many in use.
+	MaxSize int
+	// IdleTimeout evicts isolates that have not been used for that long. They
+	// are checked every IdleTimeout/2, but at most every millisecond.
+	IdleTimeout time.Duration
+	// MaxUses recycles an isolate after it has been put back that many times.
+	MaxUses int
+	// MaxUsedHeapBytes recycles an isolate when it is put back if the used
+	// size of its heap, as reported by GetHeapStatistics, is larger.
+	MaxUsedHeapBytes uint64
+
+	// Init, if not nil, initializes the Context of each new isolate, e.g. with
+	// v8console.Config.Inject. If it returns an error, the isolate is
+	// discarded and Get or NewPool returns the error.
+	Init func(*Context) error
+}
+
+// Pool is a pool of isolates, each with a single Context, that can be shared
+// by many goroutines, e.g. to handle concurrent HTTP requests:
+//
+//     pool, err := v8.NewPool(v8.PoolOptions{
+//         Isolate: v8.IsolateOptions{Snapshot: snapshot},
+//         MaxSize: runtime.NumCPU(),
+//     })
+//     ...
+//     ctx, err := pool.Get(r.Context())
+//     if err != nil { ... }
+//     defer pool.Put(ctx)
+//     html, err := ctx.Eval(`render()`, "render.js")
+//
+// A Context is reused until it is recycled, so any state that the javascript
+// leaves behind is visible to the next user of the Context.
+type Pool struct {
+	opts PoolOptions
+
+	mu      sync.Mutex
+	idle    []*pooled            // the most recently used last
+	inUse   map[*Context]*pooled // by the Context returned by Get
+	size    int                  // the number of isolates, idle or in use
+	changed chan struct{}        // closed whenever an isolate is put back
+	closed  bool
+	stop    chan struct{}
+}
+
+type pooled struct {
+	ctx      *Context
+	uses     int
+	lastUsed time.Time
+}
+
+// NewPool creates a new Pool with MinSize isolates.
+func NewPool(opts PoolOptions) (*Pool, error) {
+	if opts.MaxSize > 0 && opts.MinSize > opts.MaxSize {
+		return nil, errors.New("Cannot create a Pool with MinSize larger than MaxSize")
+	}
+	p := &Pool{
+		opts:    opts,
+		inUse:   map[*Context]*pooled{},
+		changed: make(chan struct{}),
+		stop:    make(chan struct{}),
+	}
+	for i := 0; i < opts.MinSize; i++ {
+		pc, err := p.newPooled()
+		if err != nil {
+			for _, pc := range p.idle {
+				pc.release()
+			}
+			return nil, err
+		}
+		p.idle = append(p.idle, pc)
+		p.size++
+	}
+	if opts.IdleTimeout > 0 {
+		go p.evictLoop()
+	}
+	return p, nil
+}
+
+// Get returns the Context of an idle isolate, or of a new isolate if there is
+// none and the pool is not full. Otherwise it waits until another goroutine
+// puts an isolate back or ctx is done. The Context must be returned with Put
+// once it's no longer used.
+func (p *Pool) Get(ctx context.Context) (*Context, error) {
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		if n := len(p.idle); n > 0 {
+			pc := p.idle[n-1]
+			p.idle[n-1] = nil
+			p.idle = p.idle[:n-1]
+			p.inUse[pc.ctx] = pc
+			p.mu.Unlock()
+			return pc.ctx, nil
+		}
+		if p.opts.MaxSize <= 0 || p.size < p.opts.MaxSize {
+			p.size++
+			p.mu.Unlock()
+			pc, err := p.newPooled()
+			p.mu.Lock()
+			if err != nil {
+				p.size--
+				p.broadcast()
+			} else {
+				p.inUse[pc.ctx] = pc
+			}
+			p.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return pc.ctx, nil
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Put returns a Context previously returned by Get to the pool. The Context,
+// and any of its Values, must not be used afterwards. Put recycles the
+// isolate if it reached MaxUses or MaxUsedHeapBytes.
+func (p *Pool) Put(ctx *Context) {
+	p.mu.Lock()
+	pc := p.inUse[ctx]
+	if pc == nil {
+		p.mu.Unlock()
+		panic("Cannot put a Context that was not returned by Get")
+	}
+	delete(p.inUse, ctx)
+	pc.uses++
+	pc.lastUsed = time.Now()
+
+	discard := p.closed || p.shouldRecycle(pc)
+	if discard {
+		p.size--
+	} else {
+		p.idle = append(p.idle, pc)
+	}
+	p.broadcast()
+	p.mu.Unlock()
+
+	if discard {
+		pc.release()
+	}
+}
+
+// Close discards all idle isolates and makes Get fail with ErrPoolClosed.
+// Isolates that are in use are discarded when they are put back.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.stop)
+	idle := p.idle
+	p.size -= len(p.idle)
+	p.idle = nil
+	p.broadcast()
+	p.mu.Unlock()
+
+	for _, pc := range idle {
+		pc.release()
+	}
+}
+
+func (p *Pool) newPooled() (*pooled, error) {
+	iso := NewIsolateWithOptions(p.opts.Isolate)
+	var ctx *Context
+	if p.opts.SnapshotContext != "" {
+		var err error
+		if ctx, err = iso.NewContextFromSnapshot(p.opts.SnapshotContext); err != nil {
+			iso.release()
+			return nil, err
+		}
+	} else {
+		ctx = iso.NewContext()
+	}
+	pc := &pooled{ctx: ctx, lastUsed: time.Now()}
+	if p.opts.Init != nil {
+		if err := p.opts.Init(ctx); err != nil {
+			pc.release()
+			return nil, err
+		}
+	}
+	return pc, nil
+}
+
+// release disposes of the isolate right away rather than leaving it to the
+// finalizers, since the garbage collector doesn't know how much memory the
+// isolate holds. The Context is released first, which waits for the finalizers
+// of its Values and Scripts that are running and keeps those that run later
+// from using the isolate.
+func (pc *pooled) release() {
+	iso := pc.ctx.iso
+	pc.ctx.release()
+	iso.release()
+}
+
+func (p *Pool) shouldRecycle(pc *pooled) bool {
+	if p.opts.MaxUses > 0 && pc.uses >= p.opts.MaxUses {
+		return true
+	}
+	return p.opts.MaxUsedHeapBytes > 0 &&
+		pc.ctx.iso.GetHeapStatistics().UsedHeapSize > p.opts.MaxUsedHeapBytes
+}
+
+// broadcast wakes up all goroutines waiting in Get. p.mu must be held.
+func (p *Pool) broadcast() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+func (p *Pool) evictLoop() {
+	interval := p.opts.IdleTimeout / 2
+	if interval < minEvictInterval {
+		interval = minEvictInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			p.evictIdle(now)
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// evictIdle discards the isolates that have been idle for longer than
+// IdleTimeout at the time now, but keeps at least MinSize isolates.
+func (p *Pool) evictIdle(now time.Time) {
+	p.mu.Lock()
+	// The least recently used isolates are first.
+	n := 0
+	for n < len(p.idle) && p.size-n > p.opts.MinSize &&
+		now.Sub(p.idle[n].lastUsed) > p.opts.IdleTimeout {
+		n++
+	}
+	evicted := p.idle[:n]
+	if n > 0 {
+		p.idle = append([]*pooled(nil), p.idle[n:]...)
+		p.size -= n
+	}
+	p.mu.Unlock()
+
+	for _, pc := range evicted {
+		pc.release()
+	}
+}
@@ -0,0 +1,218 @@
+package v8
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	snapshot, err := CreateSnapshotE(`var n = 0; function next() { return ++n; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inits := 0
+	p, err := NewPool(PoolOptions{
+		Isolate: IsolateOptions{Snapshot: snapshot},
+		MinSize: 1,
+		MaxSize: 2,
+		MaxUses: 3,
+		Init: func(ctx *Context) error {
+			inits++
+			_, err := ctx.Eval(`var initialized = true`, "init.js")
+			return err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if inits != 1 {
+		t.Errorf("Expected MinSize isolates to be initialized, got %d", inits)
+	}
+
+	for i := 1; i <= 4; i++ {
+		ctx, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := ctx.Eval(`initialized && next()`, "next.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The isolate is reused until it's recycled after 3 uses.
+		if expected := int64((i-1)%3 + 1); res.Int64() != expected {
+			t.Errorf("Use %d: expected %d, got %v", i, expected, res)
+		}
+		p.Put(ctx)
+	}
+	if inits != 2 {
+		t.Errorf("Expected the isolate to be recycled, got %d inits", inits)
+	}
+
+	// The pool is full with two isolates in use.
+	a, _ := p.Get(context.Background())
+	b, _ := p.Get(context.Background())
+	if a == nil || b == nil || a == b {
+		t.Fatalf("Expected two different contexts")
+	}
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(timeout); err != context.DeadlineExceeded {
+		t.Errorf("Expected a timeout from a full pool, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx, err := p.Get(context.Background())
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		p.Put(ctx)
+	}()
+	p.Put(a)
+	wg.Wait()
+	p.Put(b)
+
+	p.Close()
+	if _, err := p.Get(context.Background()); err != ErrPoolClosed {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestPoolRecycling(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewPool(PoolOptions{MaxUsedHeapBytes: 8 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.Eval(`var garbage = new Array(1 << 22).fill('x');`, "garbage.js"); err != nil {
+		t.Fatal(err)
+	}
+	val, err := ctx.Eval(`garbage`, "value.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := ctx.Compile(`1`, "script.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	iso := ctx.iso
+	p.Put(ctx)
+	if len(p.idle) != 0 || p.size != 0 {
+		t.Errorf("Expected the isolate to be recycled: %d idle, %d total", len(p.idle), p.size)
+	}
+	if ctx.ptr != nil || iso.ptr != nil {
+		t.Errorf("Expected the recycled isolate to be released")
+	}
+	// Like their finalizers, releasing the Context's Values and Scripts
+	// afterwards doesn't use the isolate.
+	val.release()
+	script.release()
+
+	ctx, _ = p.Get(context.Background())
+	p.Put(ctx)
+	if len(p.idle) != 1 {
+		t.Errorf("Expected the isolate to be kept: %d idle", len(p.idle))
+	}
+}
+
+func TestPoolIdleEviction(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewPool(PoolOptions{MinSize: 1, IdleTimeout: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	a, _ := p.Get(context.Background())
+	b, _ := p.Get(context.Background())
+	p.Put(a)
+	p.Put(b)
+	if p.size != 2 {
+		t.Fatalf("Expected 2 isolates, got %d", p.size)
+	}
+
+	p.evictIdle(time.Now())
+	if p.size != 2 {
+		t.Errorf("Expected no eviction before the timeout, got %d isolates", p.size)
+	}
+	p.evictIdle(time.Now().Add(2 * time.Hour))
+	if p.size != 1 || len(p.idle) != 1 {
+		t.Errorf("Expected eviction down to MinSize, got %d isolates", p.size)
+	}
+	// The least recently used one was evicted.
+	if a.ptr != nil || b.ptr == nil || p.idle[0].ctx != b {
+		t.Errorf("Expected the first isolate to be released")
+	}
+
+	p.Close()
+	if b.ptr != nil {
+		t.Errorf("Expected Close to release the idle isolates")
+	}
+}
+
+func TestPoolShortIdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	p, err := NewPool(PoolOptions{IdleTimeout: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(ctx)
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		p.mu.Lock()
+		size := p.size
+		p.mu.Unlock()
+		if size == 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Expected the idle isolate to be evicted")
+		}
+	}
+}
+
+func TestPoolInitError(t *testing.T) {
+	t.Parallel()
+
+	initErr := errors.New("init failed")
+	if _, err := NewPool(PoolOptions{MinSize: 1, Init: func(*Context) error { return initErr }}); err != initErr {
+		t.Errorf("Expected the init error, got %v", err)
+	}
+
+	p, err := NewPool(PoolOptions{MaxSize: 1, Init: func(*Context) error { return initErr }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i := 0; i < 2; i++ {
+		if _, err := p.Get(context.Background()); err != initErr {
+			t.Errorf("Expected the init error, got %v", err)
+		}
+	}
+
+	if _, err := NewPool(PoolOptions{SnapshotContext: "missing", MinSize: 1}); err == nil {
+		t.Errorf("Expected an error for a missing snapshot context")
+	}
+}
@@ -0,0 +1,155 @@
+package v8
+
+import (
+	"context"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// Resolver allows Go code to create a javascript promise and settle it later,
+// for example after some asynchronous Go operation has finished:
+//
+//     resolver, _ := ctx.NewPromise()
+//     ctx.Global().Set("rows", resolver.Promise()) // JS can now await rows
+//     ...
+//     val, _ := ctx.Create(queryResults)
+//     resolver.Resolve(val)
+//
+// Resolve and Reject may be called from any goroutine: like all other
+// operations on the isolate, they lock it, so they wait for any javascript
+// that is running in it to return. Settling the promise wakes up the
+// goroutines that Await promises of the isolate.
+type Resolver struct {
+	ctx      *Context
+	resolver *Value
+	promise  *Value
+}
+
+// NewPromise creates a new pending promise that is settled by calling Resolve
+// or Reject on the returned Resolver.
+func (ctx *Context) NewPromise() (*Resolver, error) {
+	resolver, err := ctx.split(C.v8_Context_NewResolver(ctx.ptr))
+	if err != nil {
+		return nil, err
+	}
+	promise, err := ctx.split(C.v8_Resolver_GetPromise(ctx.ptr, resolver.ptr))
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{ctx, resolver, promise}, nil
+}
+
+// Promise returns the promise controlled by this resolver.
+func (r *Resolver) Promise() *Value { return r.promise }
+
+// Resolve fulfills the promise with the specified value. A nil value resolves
+// the promise with undefined. If the promise has already been settled, this
+// does nothing.
+//
+// Any microtasks that are waiting on the promise (e.g. .then() handlers or
+// await'ing async functions) are run before Resolve returns.
+func (r *Resolver) Resolve(val *Value) error {
+	return r.settle(val, false)
+}
+
+// Reject rejects the promise with the specified value, which is usually an
+// Error. A nil value rejects the promise with undefined. If the promise has
+// already been settled, this does nothing.
+//
+// Any microtasks that are waiting on the promise (e.g. .catch() handlers or
+// await'ing async functions) are run before Reject returns.
+func (r *Resolver) Reject(val *Value) error {
+	return r.settle(val, true)
+}
+
+func (r *Resolver) settle(val *Value, reject bool) error {
+	if val == nil {
+		var err error
+		if val, err = r.ctx.Create(nil); err != nil {
+			return err
+		}
+	}
+	addRef(r.ctx)
+	defer decRef(r.ctx)
+	if reject {
+		_, err := r.ctx.split(C.v8_Resolver_Reject(r.ctx.ptr, r.resolver.ptr, val.ptr))
+		r.ctx.iso.notifySettled()
+		return err
+	}
+	_, err := r.ctx.split(C.v8_Resolver_Resolve(r.ctx.ptr, r.resolver.ptr, val.ptr))
+	r.ctx.iso.notifySettled()
+	return err
+}
+
+func (i *Isolate) notifySettled() {
+	i.settledMutex.Lock()
+	close(i.settled)
+	i.settled = make(chan struct{})
+	i.settledMutex.Unlock()
+}
+
+// settledChan returns a channel that is closed when a Resolver settles the
+// next promise.
+func (i *Isolate) settledChan() <-chan struct{} {
+	i.settledMutex.Lock()
+	defer i.settledMutex.Unlock()
+	return i.settled
+}
+
+// Await waits for this promise to settle, running the isolate's microtasks as
+// necessary, and returns the fulfilled value. If the promise is rejected, the
+// returned error is a *JSError describing the rejection. If this value is not a
+// promise, it is returned as-is, just like javascript's await.
+//
+// If the promise is still pending once all microtasks have run, Await blocks
+// until the promise is settled by a Resolver from another goroutine or until
+// ctx is done. In that case the returned error is a *TerminatedError wrapping
+// ctx.Err(), and the javascript is terminated (see Isolate.Terminate) if it's
+// running, like with EvalContext.
+//
+// The microtasks run as part of a Go call on v's Context: Go callbacks bound on
+// other Contexts that they call throw an exception.
+func (v *Value) Await(ctx context.Context) (*Value, error) {
+	if !v.IsKind(KindPromise) {
+		return v, nil
+	}
+
+	iso := v.ctx.iso
+	for {
+		// Promises that are settled from now on wake us up, even while we
+		// check the state.
+		settled := iso.settledChan()
+		// The isolate is only held while the microtasks run, so that other
+		// goroutines can settle the promise while we wait.
+		iso.doUntilDone(ctx, func() {
+			addRef(v.ctx)
+			C.v8_Isolate_RunMicrotasks(iso.ptr)
+			decRef(v.ctx)
+		})
+		if err := ctx.Err(); err != nil {
+			return nil, &TerminatedError{err}
+		}
+
+		state, result, err := v.PromiseInfo()
+		if err != nil {
+			return nil, err
+		}
+		switch state {
+		case PromiseStateResolved:
+			return result, nil
+		case PromiseStateRejected:
+			return nil, newRejectionError(result)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, &TerminatedError{ctx.Err()}
+		case <-settled:
+		}
+	}
+}
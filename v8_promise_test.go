@@ -0,0 +1,261 @@
+package v8
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolverResolve(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	var logs []string
+	ctx.Global().Set("log", ctx.Bind("log", func(in CallbackArgs) (*Value, error) {
+		logs = append(logs, in.Arg(0).String())
+		return nil, nil
+	}))
+
+	resolver, err := ctx.NewPromise()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Global().Set("fromGo", ctx.Bind("fromGo", func(in CallbackArgs) (*Value, error) {
+		return resolver.Promise(), nil
+	}))
+
+	if _, err := ctx.Eval(`
+		(async function() {
+			log('waiting');
+			let v = await fromGo();
+			log('got:' + v);
+		})();
+	`, "resolve.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, _, err := resolver.Promise().PromiseInfo(); err != nil {
+		t.Fatal(err)
+	} else if state != PromiseStatePending {
+		t.Errorf("Expected promise to be pending, but got %v", state)
+	}
+
+	val, _ := ctx.Create(42)
+	if err := resolver.Resolve(val); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, result, err := resolver.Promise().PromiseInfo(); err != nil {
+		t.Fatal(err)
+	} else if state != PromiseStateResolved {
+		t.Errorf("Expected promise to be resolved, but got %v", state)
+	} else if result.Int64() != 42 {
+		t.Errorf("Expected 42, got %v", result)
+	}
+
+	if exp := []string{"waiting", "got:42"}; !reflect.DeepEqual(logs, exp) {
+		t.Errorf("Wrong logs.\nGot: %#q\nExp: %#q", logs, exp)
+	}
+
+	// Settling again does nothing.
+	if err := resolver.Reject(nil); err != nil {
+		t.Fatal(err)
+	}
+	if state, _, _ := resolver.Promise().PromiseInfo(); state != PromiseStateResolved {
+		t.Errorf("Expected promise to stay resolved, but got %v", state)
+	}
+}
+
+func TestResolverReject(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	resolver, err := ctx.NewPromise()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Global().Set("p", resolver.Promise())
+	if _, err := ctx.Eval(`var caught; p.catch(e => { caught = e.message })`, "reject.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	errVal, err := ctx.Eval(`new Error('nope')`, "error.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolver.Reject(errVal); err != nil {
+		t.Fatal(err)
+	}
+
+	if state, _, _ := resolver.Promise().PromiseInfo(); state != PromiseStateRejected {
+		t.Errorf("Expected promise to be rejected, but got %v", state)
+	}
+	if caught, err := ctx.Eval(`caught`, "caught.js"); err != nil {
+		t.Fatal(err)
+	} else if caught.String() != "nope" {
+		t.Errorf("Expected catch handler to run, got %q", caught)
+	}
+}
+
+func TestAwait(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	p, err := ctx.Eval(`
+		(async function() {
+			let a = await Promise.resolve(3);
+			let b = await new Promise(resolve => resolve(4));
+			return a * b;
+		})()
+	`, "await.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := p.Await(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if res.Int64() != 12 {
+		t.Errorf("Expected 12, got %v", res)
+	}
+
+	// Non-promises are returned as-is.
+	num, _ := ctx.Create(5)
+	if res, err := num.Await(context.Background()); err != nil || res != num {
+		t.Errorf("Expected the value to be returned as-is, got %v, %v", res, err)
+	}
+}
+
+func TestAwaitRejected(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	p, err := ctx.Eval(`(async () => { throw new TypeError("bad type") })()`, "reject.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Await(context.Background())
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) {
+		t.Fatalf("Expected a *JSError, got %#v", err)
+	} else if jsErr.Name != "TypeError" || jsErr.Message != "bad type" {
+		t.Errorf("Wrong error: %q %q", jsErr.Name, jsErr.Message)
+	}
+}
+
+func TestAwaitResolvedFromGo(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	resolver, err := ctx.NewPromise()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Global().Set("fromGo", resolver.Promise())
+	p, err := ctx.Eval(`(async () => (await fromGo) + 1)()`, "go.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		val, _ := ctx.Create(41)
+		resolver.Resolve(val)
+	}()
+
+	res, err := p.Await(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	} else if res.Int64() != 42 {
+		t.Errorf("Expected 42, got %v", res)
+	}
+}
+
+func TestAwaitConcurrently(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	resolver, err := ctx.NewPromise()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Global().Set("fromGo", resolver.Promise())
+	// All goroutines that await promises of the isolate are woken up.
+	const n = 4
+	results := make(chan error, n)
+	for i := 0; i < n; i++ {
+		p, err := ctx.Eval(`(async () => await fromGo)()`, "go.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			_, err := p.Await(context.Background())
+			results <- err
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	val, _ := ctx.Create(42)
+	resolver.Resolve(val)
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Only %d of %d goroutines were woken up", i, n)
+		}
+	}
+}
+
+func TestAwaitCallbackOfOtherContext(t *testing.T) {
+	t.Parallel()
+	iso := NewIsolate()
+	ctx, other := iso.NewContext(), iso.NewContext()
+
+	called := false
+	cb := other.Bind("cb", func(CallbackArgs) (*Value, error) {
+		called = true
+		return nil, nil
+	})
+	ctx.Global().Set("cb", cb)
+	p, err := ctx.Eval(`Promise.resolve().then(() => cb())`, "other.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The callback throws rather than panicking.
+	_, err = p.Await(context.Background())
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) || !strings.Contains(err.Error(), "Cannot call a Go callback") || called {
+		t.Errorf("Expected the callback to throw, got %v", err)
+	}
+}
+
+func TestAwaitCancelled(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	p, err := ctx.Eval(`new Promise(() => {})`, "pending.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Await(timeout)
+	var terr *TerminatedError
+	if !errors.As(err, &terr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a *TerminatedError for the deadline, got %#v", err)
+	}
+
+	// The isolate is still usable afterwards.
+	if res, err := ctx.Eval(`1+1`, "after.js"); err != nil {
+		t.Fatal(err)
+	} else if res.Int64() != 2 {
+		t.Errorf("Expected 2, got %v", res)
+	}
+}
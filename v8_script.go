@@ -0,0 +1,129 @@
+package v8
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// Script is compiled javascript code that can be run many times, in any
+// Context of the Isolate it was compiled in, without compiling it again.
+type Script struct {
+	ctx      *Context // The context used for compilation.
+	ptr      C.ScriptPtr
+	code     string
+	filename string
+	rejected bool
+}
+
+// Compile compiles the javascript code without running it. The filename
+// parameter is informational only -- it is shown in javascript stack traces.
+func (ctx *Context) Compile(code, filename string) (*Script, error) {
+	return ctx.CompileWithCache(code, filename, nil)
+}
+
+// CompileWithCache is like Compile, but uses a code cache previously returned
+// by Script.CodeCache to skip most of the compilation. The cache may come from
+// another isolate or process, but V8 rejects it if it was created for other
+// code or by another V8 version or configuration. In that case the code is
+// compiled from scratch and CacheRejected reports true.
+func (ctx *Context) CompileWithCache(code, filename string, cache []byte) (*Script, error) {
+	code_cstr := C.CString(code)
+	defer C.free(unsafe.Pointer(code_cstr))
+	filename_cstr := C.CString(filename)
+	defer C.free(unsafe.Pointer(filename_cstr))
+
+	var cache_arr C.ByteArray
+	if len(cache) > 0 {
+		cache_arr.ptr = (*C.char)(C.CBytes(cache))
+		cache_arr.len = C.int(len(cache))
+		defer C.free(unsafe.Pointer(cache_arr.ptr))
+	}
+
+	ret := C.v8_Context_Compile(ctx.ptr, code_cstr, filename_cstr, cache_arr)
+	if ret.Script == nil {
+		return nil, ctx.convertError(ret.error_msg, ret.exception)
+	}
+	s := &Script{ctx, ret.Script, code, filename, ret.CacheRejected != 0}
+	runtime.SetFinalizer(s, (*Script).release)
+	return s, nil
+}
+
+// Run runs the script in the specified Context, which must belong to the same
+// Isolate that the script was compiled in.
+func (s *Script) Run(ctx *Context) (*Value, error) {
+	if ctx.iso != s.ctx.iso {
+		return nil, errors.New("Cannot run a Script in a Context of another Isolate")
+	}
+	addRef(ctx)
+	defer decRef(ctx)
+	return ctx.split(C.v8_Script_Run(ctx.ptr, s.ptr))
+}
+
+// CodeCache returns V8's code cache for the script, which may be saved and
+// passed to CompileWithCache later, e.g. after the process restarts. The cache
+// includes the code of any functions that have been compiled so far, so
+// running the script before calling CodeCache usually makes the cache more
+// effective. It returns nil if V8 didn't produce a cache.
+func (s *Script) CodeCache() []byte {
+	code_cstr := C.CString(s.code)
+	defer C.free(unsafe.Pointer(code_cstr))
+	filename_cstr := C.CString(s.filename)
+	defer C.free(unsafe.Pointer(filename_cstr))
+
+	data := C.v8_Script_CodeCache(s.ctx.ptr, s.ptr, code_cstr, filename_cstr)
+	if data.ptr == nil {
+		return nil
+	}
+	defer C.free(unsafe.Pointer(data.ptr))
+	return C.GoBytes(unsafe.Pointer(data.ptr), data.len)
+}
+
+// CacheRejected reports whether the code cache passed to CompileWithCache was
+// rejected by V8.
+func (s *Script) CacheRejected() bool { return s.rejected }
+
+func (s *Script) release() {
+	if s.ptr != nil {
+		s.ctx.releaseMutex.RLock()
+		// Like Values, the Script can't be released once its Context or
+		// isolate has been.
+		if s.ctx.ptr != nil && s.ctx.iso != nil && s.ctx.iso.ptr != nil {
+			C.v8_Script_Release(s.ctx.iso.ptr, s.ptr)
+		}
+		s.ctx.releaseMutex.RUnlock()
+	}
+	s.ctx = nil
+	s.ptr = nil
+	runtime.SetFinalizer(s, nil)
+}
+
+// CheckSyntax compiles the javascript code without running it and returns a
+// *SyntaxError if it is invalid. The filename parameter is only used in the
+// error's Location.
+func (i *Isolate) CheckSyntax(code, filename string) error {
+	code_cstr := C.CString(code)
+	defer C.free(unsafe.Pointer(code_cstr))
+	filename_cstr := C.CString(filename)
+	defer C.free(unsafe.Pointer(filename_cstr))
+
+	exception := C.v8_Isolate_CheckSyntax(i.ptr, code_cstr, filename_cstr)
+	if exception == nil {
+		return nil
+	}
+	defer C.free(unsafe.Pointer(exception))
+	takeFrames(exception.Frames, exception.NumFrames) // compilation has no stack
+	return &SyntaxError{
+		Name:       takeString(exception.Name),
+		Message:    takeString(exception.Message),
+		SourceLine: takeString(exception.SourceLine),
+		Location:   takeLoc(exception.Location),
+	}
+}
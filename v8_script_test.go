@@ -0,0 +1,153 @@
+package v8
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScriptRunInContexts(t *testing.T) {
+	t.Parallel()
+	iso := NewIsolate()
+	ctx1, ctx2 := iso.NewContext(), iso.NewContext()
+
+	script, err := ctx1.Compile(`var runs = (typeof runs == 'number' ? runs : 0) + 1`, "runs.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, ctx := range []*Context{ctx1, ctx1, ctx2} {
+		if _, err := script.Run(ctx); err != nil {
+			t.Fatalf("Run %d: %v", i, err)
+		}
+	}
+	for i, exp := range []int64{2, 1} {
+		ctx := []*Context{ctx1, ctx2}[i]
+		if runs, err := ctx.Eval(`runs`, "check.js"); err != nil {
+			t.Fatal(err)
+		} else if runs.Int64() != exp {
+			t.Errorf("Context %d: expected %d runs, got %v", i, exp, runs)
+		}
+	}
+
+	if _, err := script.Run(NewIsolate().NewContext()); err == nil {
+		t.Error("Expected an error running the script in another isolate")
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	var jsErr *JSError
+	if _, err := ctx.Compile(`function (`, "syntax.js"); !errors.As(err, &jsErr) {
+		t.Errorf("Expected a *JSError, got %#v", err)
+	} else if jsErr.Name != "SyntaxError" || jsErr.Location.Filename != "syntax.js" {
+		t.Errorf("Wrong error: %q at %#v", jsErr.Name, jsErr.Location)
+	}
+
+	script, err := ctx.Compile(`throw new TypeError('oops')`, "throw.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := script.Run(ctx); !errors.As(err, &jsErr) {
+		t.Errorf("Expected a *JSError, got %#v", err)
+	} else if jsErr.Name != "TypeError" || jsErr.Message != "oops" {
+		t.Errorf("Wrong error: %q %q", jsErr.Name, jsErr.Message)
+	}
+}
+
+func TestScriptCodeCache(t *testing.T) {
+	t.Parallel()
+	const code = `function fib(n) { return n < 2 ? n : fib(n-1) + fib(n-2) }; fib(10)`
+
+	ctx := NewIsolate().NewContext()
+	script, err := ctx.Compile(code, "fib.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := script.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cache := script.CodeCache()
+	if len(cache) == 0 {
+		t.Fatal("Expected a code cache")
+	}
+
+	// The cache is usable in a fresh isolate.
+	ctx = NewIsolate().NewContext()
+	script, err = ctx.CompileWithCache(code, "fib.js", cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script.CacheRejected() {
+		t.Error("Expected the code cache to be accepted")
+	}
+	if res, err := script.Run(ctx); err != nil {
+		t.Fatal(err)
+	} else if res.Int64() != 55 {
+		t.Errorf("Expected 55, got %v", res)
+	}
+
+	// A cache for different code is rejected, but the code still works.
+	script, err = NewIsolate().NewContext().CompileWithCache(`fib = 3`, "other.js", cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !script.CacheRejected() {
+		t.Error("Expected the code cache to be rejected")
+	}
+	corrupt := append([]byte(nil), cache...)
+	for i := range corrupt {
+		corrupt[i] ^= 0xff
+	}
+	script, err = NewIsolate().NewContext().CompileWithCache(code, "fib.js", corrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !script.CacheRejected() {
+		t.Error("Expected the corrupt code cache to be rejected")
+	}
+}
+
+func TestCheckSyntax(t *testing.T) {
+	t.Parallel()
+	iso := NewIsolate()
+
+	if err := iso.CheckSyntax(`throw new Error('not run')`, "valid.js"); err != nil {
+		t.Errorf("Expected valid syntax, got %v", err)
+	}
+
+	err := iso.CheckSyntax("var ok = 1;\nvar x = (1 + ;\n", "invalid.js")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected a *SyntaxError, got %#v", err)
+	}
+	if syntaxErr.Name != "SyntaxError" || syntaxErr.Message == "" {
+		t.Errorf("Wrong error: %q %q", syntaxErr.Name, syntaxErr.Message)
+	}
+	if syntaxErr.SourceLine != "var x = (1 + ;" {
+		t.Errorf("Wrong source line: %q", syntaxErr.SourceLine)
+	}
+	loc := syntaxErr.Location
+	if loc.Filename != "invalid.js" || loc.Line != 2 || loc.Column != 14 {
+		t.Errorf("Wrong location: %#v", loc)
+	}
+}
+
+func TestScriptReleasedAfterIsolate(t *testing.T) {
+	t.Parallel()
+	iso := NewIsolate()
+	ctx := iso.NewContext()
+	script, err := ctx.Compile(`1`, "script.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Like its finalizer, releasing the Script after its isolate doesn't use
+	// the isolate.
+	iso.release()
+	script.release()
+	if script.ptr != nil {
+		t.Errorf("Expected the script to be released")
+	}
+	ctx.ptr = nil // disposed of with the isolate
+}
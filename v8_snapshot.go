@@ -0,0 +1,321 @@
+package v8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"unsafe"
+)
+
+// #include <stdlib.h>
+// #include <string.h>
+// #include "v8_c_bridge.h"
+// #cgo CXXFLAGS: -I${SRCDIR} -I${SRCDIR}/include -fno-rtti -fpic -std=c++11
+// #cgo LDFLAGS: -pthread -L${SRCDIR}/libv8 -lv8_base -lv8_init -lv8_initializers -lv8_libbase -lv8_libplatform -lv8_libsampler -lv8_nosnapshot
+import "C"
+
+// SnapshotBuilder creates Snapshots whose javascript may refer to Go
+// callbacks, unlike CreateSnapshot:
+//
+//     b := v8.NewSnapshotBuilder()
+//     b.Bind("fetch", fetchCallback)
+//     snapshot, err := b.Create(`var api = { get: url => fetch(url) };`)
+//     ...
+//     ctx := v8.NewIsolateWithSnapshot(snapshot).NewContext()
+//     ctx.Eval(`api.get("/users")`, "main.js") // calls fetchCallback
+//
+// The callbacks are stored in the snapshot by name. Every Context created from
+// the snapshot calls the Go callbacks of the Snapshot, and CallbackArgs.Context
+// is the calling Context.
+//
+// Besides the default context that NewContext creates, a snapshot may contain
+// named contexts, each with its own javascript, that NewContextFromSnapshot
+// creates:
+//
+//     b.AddContext("ssr", ssrBundle)
+//     b.AddContext("validation", validationBundle)
+//     snapshot, err := b.Create("")
+//     ...
+//     ctx, err := v8.NewIsolateWithSnapshot(snapshot).NewContextFromSnapshot("ssr")
+type SnapshotBuilder struct {
+	callbacks map[string]Callback
+	contexts  []snapshotContext // the named contexts in order
+	warmUps   map[string]string // warm-up code by context name
+	keepCode  bool
+}
+
+type snapshotContext struct {
+	name, js string
+}
+
+// NewSnapshotBuilder creates a new, empty SnapshotBuilder.
+func NewSnapshotBuilder() *SnapshotBuilder {
+	return &SnapshotBuilder{
+		callbacks: map[string]Callback{},
+		warmUps:   map[string]string{},
+	}
+}
+
+// AddContext adds a context with the specified name to the snapshot, which
+// runs the javascript code before the snapshot is created. Every named context
+// is independent of the default context and of all other named contexts.
+func (b *SnapshotBuilder) AddContext(name, js string) {
+	b.contexts = append(b.contexts, snapshotContext{name, js})
+}
+
+// WarmUp sets javascript code that runs in the named context, or in the
+// default context if name is empty, so that V8 compiles the functions it calls
+// before the snapshot is created. The snapshot keeps the compiled code but
+// none of the effects of the warm-up code: it runs in a throwaway copy of the
+// context.
+func (b *SnapshotBuilder) WarmUp(name, js string) {
+	b.warmUps[name] = js
+}
+
+// KeepFunctionCode sets whether the snapshot keeps the code of the functions
+// that V8 compiled while running the javascript, which makes the snapshot
+// bigger but the first calls faster. It is implied by WarmUp.
+func (b *SnapshotBuilder) KeepFunctionCode(keep bool) {
+	b.keepCode = keep
+}
+
+// Bind makes the Go callback available as the global function name to the
+// snapshot's javascript. The javascript may keep references to the function
+// anywhere, but cannot call it until the snapshot is loaded: calls while
+// creating the snapshot throw an exception.
+func (b *SnapshotBuilder) Bind(name string, cb Callback) {
+	b.callbacks[name] = cb
+}
+
+// Create runs the javascript code in the default context, as well as the code
+// of every named context, and creates a snapshot of the resulting state. If any
+// code throws an exception, it returns a *JSError without Value instead.
+func (b *SnapshotBuilder) Create(js string) (*Snapshot, error) {
+	indexes := map[string]int{}
+	for i, c := range b.contexts {
+		if c.name == "" {
+			return nil, errors.New("Cannot add a snapshot context without a name")
+		} else if _, dup := indexes[c.name]; dup {
+			return nil, fmt.Errorf("Cannot add snapshot context %q twice", c.name)
+		}
+		indexes[c.name] = i + 1 // 0 is the default context
+	}
+	for name := range b.warmUps {
+		if _, ok := indexes[name]; name != "" && !ok {
+			return nil, fmt.Errorf("Cannot warm up unknown snapshot context %q", name)
+		}
+	}
+
+	v8_init_once.Do(func() { C.v8_init() })
+
+	names := make([]string, 0, len(b.callbacks))
+	for name := range b.callbacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var namesPtr **C.char
+	if len(names) > 0 {
+		cnames := make([]*C.char, len(names))
+		for i, name := range names {
+			cnames[i] = C.CString(name)
+			defer C.free(unsafe.Pointer(cnames[i]))
+		}
+		// The array must be in C memory since it contains C pointers.
+		namesPtr = (**C.char)(C.malloc(C.size_t(len(names)) * C.size_t(unsafe.Sizeof(cnames[0]))))
+		defer C.free(unsafe.Pointer(namesPtr))
+		copy((*[1 << 20]*C.char)(unsafe.Pointer(namesPtr))[:len(names):len(names)], cnames)
+	}
+
+	contexts := append([]snapshotContext{{"", js}}, b.contexts...)
+	// Like the names, the contexts contain C pointers.
+	ccontexts := (*C.SnapshotContext)(C.calloc(C.size_t(len(contexts)), C.size_t(C.sizeof_SnapshotContext)))
+	defer C.free(unsafe.Pointer(ccontexts))
+	carr := (*[1 << 20]C.SnapshotContext)(unsafe.Pointer(ccontexts))[:len(contexts):len(contexts)]
+	for i := range carr {
+		c := &carr[i]
+		filename := "<embedded>"
+		if contexts[i].name != "" {
+			filename = "<" + contexts[i].name + ">"
+		}
+		c.js = C.CString(contexts[i].js)
+		defer C.free(unsafe.Pointer(c.js))
+		c.filename = C.CString(filename)
+		defer C.free(unsafe.Pointer(c.filename))
+		if warmUp, ok := b.warmUps[contexts[i].name]; ok {
+			c.warm_up = C.CString(warmUp)
+			defer C.free(unsafe.Pointer(c.warm_up))
+			c.warm_up_filename = C.CString(filename + " warm-up")
+			defer C.free(unsafe.Pointer(c.warm_up_filename))
+		}
+	}
+
+	var keepCode C.int
+	if b.keepCode {
+		keepCode = 1
+	}
+	ret := C.v8_CreateSnapshot(ccontexts, C.int(len(contexts)), namesPtr, C.int(len(names)), keepCode)
+	if ret.error_msg.ptr != nil {
+		err := errors.New(C.GoStringN(ret.error_msg.ptr, ret.error_msg.len))
+		C.free(unsafe.Pointer(ret.error_msg.ptr))
+		if ret.exception == nil {
+			return nil, err
+		}
+		defer C.free(unsafe.Pointer(ret.exception))
+		return nil, takeException(err, ret.exception)
+	}
+
+	s := newSnapshot(ret.data)
+	s.contexts = indexes
+	s.codeKept = b.keepCode || len(b.warmUps) > 0
+	for _, name := range names {
+		s.SetCallback(name, b.callbacks[name])
+	}
+	return s, nil
+}
+
+// snapshotMagic starts every exported snapshot.
+var snapshotMagic = [8]byte{'g', 'o', 'v', '8', 's', 'n', 'a', 'p'}
+
+// snapshotHeader precedes the snapshot data in exported snapshots. The data
+// can only be loaded by the exact V8 build that created it: V8 doesn't check
+// that itself and crashes when loading anything else.
+type snapshotHeader struct {
+	Magic                      [8]byte
+	Major, Minor, Build, Patch uint32
+	Flags                      uint32
+	Checksum                   uint32 // CRC-32 of the payload
+	Length                     uint32 // of the payload
+}
+
+// The snapshot header flags.
+const (
+	snapshotFlag64Bit uint32 = 1 << iota
+	snapshotFlagCodeKept
+)
+
+// hostSnapshotFlags are the flags that must match the host to load a snapshot.
+func hostSnapshotFlags() uint32 {
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		return snapshotFlag64Bit
+	}
+	return 0
+}
+
+// Export returns the VM state data as a byte slice, preceded by a header with
+// the V8 version, a checksum and flags so that RestoreSnapshotFromExport can
+// reject data that it cannot load. The header also contains the names of the
+// snapshot's contexts, but Go callbacks are not exported.
+func (s *Snapshot) Export() []byte {
+	var payload bytes.Buffer
+	names := make([]string, len(s.contexts))
+	for name, index := range s.contexts {
+		names[index-1] = name
+	}
+	binary.Write(&payload, binary.LittleEndian, uint32(len(names)))
+	for _, name := range names {
+		binary.Write(&payload, binary.LittleEndian, uint32(len(name)))
+		payload.WriteString(name)
+	}
+	payload.Write(C.GoBytes(unsafe.Pointer(s.data.ptr), s.data.len))
+
+	h := snapshotHeader{
+		Magic:    snapshotMagic,
+		Major:    uint32(Version.Major),
+		Minor:    uint32(Version.Minor),
+		Build:    uint32(Version.Build),
+		Patch:    uint32(Version.Patch),
+		Flags:    hostSnapshotFlags(),
+		Checksum: crc32.ChecksumIEEE(payload.Bytes()),
+		Length:   uint32(payload.Len()),
+	}
+	if s.codeKept {
+		h.Flags |= snapshotFlagCodeKept
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &h)
+	buf.Write(payload.Bytes())
+	return buf.Bytes()
+}
+
+// RestoreSnapshotFromExport creates a Snapshot from a byte slice that should
+// have previous come from Snapshot.Export(). It returns an error if the data
+// is corrupt or truncated, or if it was exported by another V8 version or on
+// another architecture.
+func RestoreSnapshotFromExport(data []byte) (*Snapshot, error) {
+	var h snapshotHeader
+	r := bytes.NewReader(data)
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil || h.Magic != snapshotMagic {
+		return nil, errors.New("Cannot restore snapshot: not an exported snapshot")
+	}
+	if int(h.Major) != Version.Major || int(h.Minor) != Version.Minor ||
+		int(h.Build) != Version.Build || int(h.Patch) != Version.Patch {
+		return nil, fmt.Errorf("Cannot restore snapshot of V8 %d.%d.%d.%d with V8 %d.%d.%d.%d",
+			h.Major, h.Minor, h.Build, h.Patch,
+			Version.Major, Version.Minor, Version.Build, Version.Patch)
+	}
+	if h.Flags&snapshotFlag64Bit != hostSnapshotFlags() {
+		return nil, errors.New("Cannot restore snapshot: exported on another architecture")
+	}
+	payload := data[len(data)-r.Len():]
+	if uint32(len(payload)) != h.Length {
+		return nil, fmt.Errorf("Cannot restore snapshot: expected %d bytes of data, got %d",
+			h.Length, len(payload))
+	}
+	if crc32.ChecksumIEEE(payload) != h.Checksum {
+		return nil, errors.New("Cannot restore snapshot: checksum mismatch")
+	}
+
+	var count uint32
+	binary.Read(r, binary.LittleEndian, &count)
+	contexts := map[string]int{}
+	for i := 1; i <= int(count); i++ {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil || int64(n) > int64(r.Len()) {
+			return nil, errors.New("Cannot restore snapshot: invalid context names")
+		}
+		name := make([]byte, n)
+		r.Read(name)
+		contexts[string(name)] = i
+	}
+	if r.Len() == 0 {
+		return nil, errors.New("Cannot restore snapshot: no snapshot data")
+	}
+
+	str := C.StartupData{
+		ptr: (*C.char)(C.malloc(C.size_t(r.Len()))),
+		len: C.int(r.Len()),
+	}
+	C.memcpy(unsafe.Pointer(str.ptr), unsafe.Pointer(&data[len(data)-r.Len()]), C.size_t(r.Len()))
+	s := newSnapshot(str)
+	s.contexts = contexts
+	s.codeKept = h.Flags&snapshotFlagCodeKept != 0
+	return s, nil
+}
+
+// SetCallback sets the Go callback that the snapshot's function name calls.
+// This is necessary for snapshots restored with RestoreSnapshotFromExport,
+// since Go callbacks are not exported. It must not be called while the
+// snapshot is in use by any Isolate.
+func (s *Snapshot) SetCallback(name string, cb Callback) {
+	if s.callbacks == nil {
+		s.callbacks = map[string]Callback{}
+	}
+	s.callbacks[name] = cb
+}
+
+// snapshotCallback returns the named callback of the isolate's snapshot. If
+// there's no such callback, the returned callback throws an exception.
+func (i *Isolate) snapshotCallback(name string) callbackInfo {
+	if i.s != nil {
+		if cb := i.s.callbacks[name]; cb != nil {
+			return callbackInfo{cb, name}
+		}
+	}
+	return callbackInfo{func(CallbackArgs) (*Value, error) {
+		return nil, fmt.Errorf("No Go callback %q was set for the snapshot", name)
+	}, name}
+}
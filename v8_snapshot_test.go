@@ -0,0 +1,227 @@
+package v8
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotBuilderCallbacks(t *testing.T) {
+	t.Parallel()
+
+	var calledFrom []*Context
+	greet := func(in CallbackArgs) (*Value, error) {
+		calledFrom = append(calledFrom, in.Context)
+		return in.Context.Create("Hi " + in.Arg(0).String())
+	}
+
+	b := NewSnapshotBuilder()
+	b.Bind("greet", greet)
+	snapshot, err := b.Create(`
+		var api = { hello: name => greet(name) + '!' };
+		var initError;
+		try { greet('nobody'); } catch (e) { initError = e.message; }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		ctx := NewIsolateWithSnapshot(snapshot).NewContext()
+		if res, err := ctx.Eval(`api.hello('Bob')`, "hello.js"); err != nil {
+			t.Fatal(err)
+		} else if res.String() != "Hi Bob!" {
+			t.Errorf("Wrong result: %q", res)
+		}
+		if len(calledFrom) != i+1 || calledFrom[i] != ctx {
+			t.Errorf("Expected callback to be called from the new context")
+		}
+		if res, err := ctx.Eval(`initError`, "init.js"); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(res.String(), "while creating a snapshot") {
+			t.Errorf("Wrong init error: %q", res)
+		}
+	}
+
+	// Callbacks are not exported, so they must be set again.
+	restored, err := RestoreSnapshotFromExport(snapshot.Export())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewIsolateWithSnapshot(restored).NewContext()
+	if _, err := ctx.Eval(`api.hello('Bob')`, "hello.js"); err == nil ||
+		!strings.Contains(err.Error(), `No Go callback "greet"`) {
+		t.Errorf("Expected missing callback error, got %v", err)
+	}
+	restored.SetCallback("greet", greet)
+	ctx = NewIsolateWithSnapshot(restored).NewContext()
+	if res, err := ctx.Eval(`api.hello('Alice')`, "hello.js"); err != nil {
+		t.Fatal(err)
+	} else if res.String() != "Hi Alice!" {
+		t.Errorf("Wrong result: %q", res)
+	}
+}
+
+func TestSnapshotBuilderError(t *testing.T) {
+	t.Parallel()
+	if _, err := NewSnapshotBuilder().Create(`throw new Error('badness')`); err == nil ||
+		!strings.Contains(err.Error(), "badness") {
+		t.Errorf("Expected the thrown error, got %v", err)
+	}
+}
+
+func TestSnapshotBuilderContexts(t *testing.T) {
+	t.Parallel()
+
+	b := NewSnapshotBuilder()
+	b.AddContext("ssr", `var render = name => '<h1>' + name + '</h1>'; var calls = 0;`)
+	b.AddContext("validation", `var valid = s => /^[a-z]+$/.test(s);`)
+	b.WarmUp("ssr", `for (var i = 0; i < 100; i++) { render('x'); calls++; }`)
+	b.WarmUp("", `Math.max(1, 2)`)
+	snapshot, err := b.Create(`var which = 'default';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iso := NewIsolateWithSnapshot(snapshot)
+	ssr, err := iso.NewContextFromSnapshot("ssr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ssr.Eval(`render('Bob') + calls`, "ssr.js"); err != nil {
+		t.Fatal(err)
+	} else if res.String() != "<h1>Bob</h1>0" {
+		t.Errorf("Wrong result: %q", res)
+	}
+	if res, err := ssr.Eval(`typeof valid + typeof which`, "ssr.js"); err != nil {
+		t.Fatal(err)
+	} else if res.String() != "undefinedundefined" {
+		t.Errorf("Named contexts must be independent, got %q", res)
+	}
+
+	validation, err := iso.NewContextFromSnapshot("validation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := validation.Eval(`valid('abc') && !valid('a1')`, "validation.js"); err != nil {
+		t.Fatal(err)
+	} else if !res.Bool() {
+		t.Errorf("Wrong result: %v", res)
+	}
+
+	if res, err := iso.NewContext().Eval(`which`, "default.js"); err != nil {
+		t.Fatal(err)
+	} else if res.String() != "default" {
+		t.Errorf("Wrong result: %q", res)
+	}
+
+	if _, err := iso.NewContextFromSnapshot("missing"); err == nil {
+		t.Errorf("Expected an error for an unknown context")
+	}
+	if _, err := NewIsolate().NewContextFromSnapshot("ssr"); err == nil {
+		t.Errorf("Expected an error for an isolate without snapshot")
+	}
+}
+
+func TestSnapshotBuilderContextErrors(t *testing.T) {
+	t.Parallel()
+
+	b := NewSnapshotBuilder()
+	b.AddContext("a", ``)
+	b.AddContext("a", ``)
+	if _, err := b.Create(``); err == nil {
+		t.Errorf("Expected an error for duplicate contexts")
+	}
+
+	b = NewSnapshotBuilder()
+	b.WarmUp("a", ``)
+	if _, err := b.Create(``); err == nil {
+		t.Errorf("Expected an error for warming up an unknown context")
+	}
+
+	b = NewSnapshotBuilder()
+	b.AddContext("a", `throw new Error('bad context')`)
+	if _, err := b.Create(``); err == nil || !strings.Contains(err.Error(), "bad context") {
+		t.Errorf("Expected the thrown error, got %v", err)
+	}
+}
+
+func TestSnapshotExport(t *testing.T) {
+	t.Parallel()
+
+	b := NewSnapshotBuilder()
+	b.AddContext("other", `var which = 'other';`)
+	snapshot, err := b.Create(`var which = 'default';`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := snapshot.Export()
+
+	restored, err := RestoreSnapshotFromExport(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := NewIsolateWithSnapshot(restored).NewContextFromSnapshot("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := ctx.Eval(`which`, "which.js"); err != nil {
+		t.Fatal(err)
+	} else if res.String() != "other" {
+		t.Errorf("Wrong result: %q", res)
+	}
+
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	stale := append([]byte(nil), data...)
+	stale[8]++ // the major version
+
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"raw":       []byte("not a snapshot"),
+		"truncated": data[:len(data)/2],
+		"corrupt":   corrupt,
+		"stale":     stale,
+	} {
+		if _, err := RestoreSnapshotFromExport(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCreateSnapshotE(t *testing.T) {
+	t.Parallel()
+
+	snapshot, err := CreateSnapshotE(`var x = 42;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := NewIsolateWithSnapshot(snapshot).NewContext().Eval(`x`, "x.js"); err != nil {
+		t.Fatal(err)
+	} else if res.Int64() != 42 {
+		t.Errorf("Wrong result: %v", res)
+	}
+
+	snapshot, err = CreateSnapshotE(`
+		function init() { throw new TypeError('bad init'); }
+		init();`)
+	if snapshot != nil {
+		t.Errorf("Expected no snapshot")
+	}
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) {
+		t.Fatalf("Expected a *JSError, got %#v", err)
+	}
+	if jsErr.Name != "TypeError" || jsErr.Message != "bad init" || jsErr.Value != nil {
+		t.Errorf("Wrong error: %#v", jsErr)
+	}
+	if jsErr.Location.Filename != "<embedded>" || jsErr.Location.Line != 2 {
+		t.Errorf("Wrong location: %#v", jsErr.Location)
+	}
+	if len(jsErr.Stack) != 2 || jsErr.Stack[0].Funcname != "init" || jsErr.Stack[1].Line != 3 {
+		t.Errorf("Wrong stack: %#v", jsErr.Stack)
+	}
+	if !strings.Contains(err.Error(), "bad init") {
+		t.Errorf("Wrong report: %q", err)
+	}
+}
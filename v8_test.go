@@ -1,6 +1,7 @@
 package v8
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -733,6 +734,88 @@ func TestTerminate(t *testing.T) {
 	}
 }
 
+func TestEvalContextDeadline(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	goctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := ctx.EvalContext(goctx, `while(1) {}`, "loop.js")
+
+	var terr *TerminatedError
+	if !errors.As(err, &terr) {
+		t.Fatalf("Expected a *TerminatedError, got %#v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", terr.Err)
+	}
+
+	// The isolate is usable again, even with the expired context.Context
+	// when the javascript is already done.
+	if res, err := ctx.Eval(`1 + 1`, "after.js"); err != nil {
+		t.Fatal(err)
+	} else if res.Int64() != 2 {
+		t.Errorf("Expected 2, got %v", res)
+	}
+	if _, err := ctx.EvalContext(goctx, `1`, "expired.js"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestEvalContextWaitingForIsolate(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	// A deadline that passes while EvalContext waits for another goroutine to
+	// release the isolate doesn't terminate the other goroutine's javascript.
+	goctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	waiting := make(chan error, 1)
+	ctx.iso.Do(func() {
+		go func() {
+			_, err := ctx.EvalContext(goctx, `1`, "waiting.js")
+			waiting <- err
+		}()
+		<-goctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		if res, err := ctx.Eval(`var n = 0; for (var i = 0; i < 1e6; i++) n++; n`, "holder.js"); err != nil {
+			t.Errorf("Expected the holder's javascript to run, got %v", err)
+		} else if res.Int64() != 1e6 {
+			t.Errorf("Expected 1e6, got %v", res)
+		}
+	})
+	if err := <-waiting; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestCallContextCanceled(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	goctx, cancel := context.WithCancel(context.Background())
+	started := ctx.Bind("started", func(CallbackArgs) (*Value, error) {
+		cancel()
+		return nil, nil
+	})
+	fn, err := ctx.Eval(`(function(started) { started(); while(1) {} })`, "fn.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fn.CallContext(goctx, nil, started)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %#v", err)
+	}
+
+	// Exceptions are still reported as such.
+	_, err = ctx.EvalContext(context.Background(), `throw new Error('oops')`, "throw.js")
+	var jsErr *JSError
+	if !errors.As(err, &jsErr) || jsErr.Message != "oops" {
+		t.Errorf("Expected the thrown error, got %#v", err)
+	}
+}
+
 func TestSnapshot(t *testing.T) {
 	t.Parallel()
 	snapshot := CreateSnapshot("zzz='hi there!';")
@@ -1283,6 +1366,59 @@ func TestContextFinalizerWithValues(t *testing.T) {
 	}
 }
 
+func TestIsolateHeapLimit(t *testing.T) {
+	t.Parallel()
+	if Version.Major < 6 || (Version.Major == 6 && Version.Minor < 7) {
+		t.Skip("V8 versions before 6.7 abort when the heap limit is exceeded.")
+	}
+
+	iso := NewIsolateWithOptions(IsolateOptions{MaxHeapBytes: 32 << 20})
+	ctx := iso.NewContext()
+	if limit := iso.GetHeapStatistics().HeapSizeLimit; limit > 128<<20 {
+		t.Errorf("Expected a heap limit near 32MB, got %d", limit)
+	}
+
+	_, err := ctx.Eval(`(function() {
+		const hog = [];
+		while (true) hog.push(new Array(1000).fill('x'));
+	})()`, "hog.js")
+	if err != ErrHeapLimitExceeded {
+		t.Fatalf("Expected ErrHeapLimitExceeded, got %v", err)
+	}
+
+	// Nothing references the garbage anymore, so the isolate may be used again.
+	if res, err := ctx.Eval(`1 + 1`, "after.js"); err != nil {
+		t.Fatal(err)
+	} else if res.Int64() != 2 {
+		t.Errorf("Expected 2, got %v", res)
+	}
+}
+
+func TestIsolateStackLimit(t *testing.T) {
+	t.Parallel()
+
+	maxDepth := func(iso *Isolate) int64 {
+		ctx := iso.NewContext()
+		res, err := ctx.Eval(`
+			let depth = 0;
+			function recurse() { depth++; recurse(); }
+			try { recurse(); } catch (e) {}
+			depth
+		`, "recurse.js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Int64()
+	}
+
+	defaultDepth := maxDepth(NewIsolate())
+	limitedDepth := maxDepth(NewIsolateWithOptions(IsolateOptions{StackLimit: 64 << 10}))
+	if limitedDepth <= 0 || limitedDepth >= defaultDepth {
+		t.Errorf("Expected the limited stack to allow less recursion: %d vs %d by default",
+			limitedDepth, defaultDepth)
+	}
+}
+
 func TestIsolateGetHeapStatistics(t *testing.T) {
 	iso := NewIsolate()
 	initHeap := iso.GetHeapStatistics()
@@ -1541,3 +1677,48 @@ func TestPanicHandling(t *testing.T) {
 	_ = NewIsolate()
 	_ = *f
 }
+
+func TestIsolateConcurrentUse(t *testing.T) {
+	t.Parallel()
+
+	iso := NewIsolate()
+	ctxs := []*Context{iso.NewContext(), iso.NewContext()}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := ctxs[i%len(ctxs)]
+			name := fmt.Sprintf("double%d", i)
+			ctx.Global().Set(name, ctx.Bind(name, func(in CallbackArgs) (*Value, error) {
+				return in.Context.Create(2 * in.Arg(0).Int64())
+			}))
+			for j := 0; j < 50; j++ {
+				res, err := ctx.Eval(fmt.Sprintf("var x = 100; %s(%d)", name, j), "double.js")
+				if err != nil {
+					t.Error(err)
+					return
+				} else if res.Int64() != int64(2*j) {
+					t.Errorf("Wrong result: %v", res)
+				}
+			}
+		}(i)
+	}
+
+	// Do keeps the other goroutines from changing x between the calls.
+	ctx := ctxs[0]
+	for i := 0; i < 50; i++ {
+		iso.Do(func() {
+			ctx.Eval(`var x = 0`, "x.js")
+			ctx.Eval(`x++`, "x.js")
+			iso.Do(func() { ctx.Eval(`x++`, "x.js") })
+			if res, err := ctx.Eval(`x`, "x.js"); err != nil {
+				t.Error(err)
+			} else if res.Int64() != 2 {
+				t.Errorf("Expected 2, got %v", res)
+			}
+		})
+	}
+	wg.Wait()
+}
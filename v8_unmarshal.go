@@ -0,0 +1,385 @@
+package v8
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Unmarshal fills the Go value pointed to by dst from this JavaScript value. It
+// is the typed counterpart of Export and the inverse of Context.Create, so a
+// Go value that is passed through Create and then Unmarshal'd comes back
+// unchanged.
+//
+// Unmarshal supports the same types as Create:
+//   * bool from JS booleans
+//   * all integers and floats from JS numbers
+//   * strings from JS strings
+//   * maps from JS objects or Map objects (keys must be strings or numbers)
+//   * time.Time values from JS Date objects
+//   * structs from JS objects
+//   * slices and arrays from JS arrays
+//   * []byte from ArrayBuffers and typed arrays as well as arrays
+//   * pointers to any of the above, which are allocated as necessary
+//   * *v8.Value (set to the JS value as-is)
+//   * interface{} (set to the result of Export)
+//
+// JS null and undefined set pointers, maps, slices, and interfaces to nil and
+// leave all other values unchanged.
+//
+// Struct fields respect the json naming entry and embedded structs are inlined,
+// exactly as with Create. Byte slices tagged as 'v8:"arraybuffer"' must be
+// ArrayBuffers or typed arrays.
+//
+// If a value cannot be converted, the returned error describes the path to the
+// offending value, for example:
+//     field "Items": index 3: expected number, got string
+func (v *Value) Unmarshal(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Unmarshal requires a non-nil pointer, got %T", dst)
+	}
+	return v.unmarshal(rv.Elem(), nil)
+}
+
+func (v *Value) unmarshal(dst reflect.Value, tags []string) error {
+	isNil := v.IsKind(KindUndefined) || v.IsKind(KindNull)
+
+	if dst.Type() == valuePtrType {
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	} else if dst.Type() == timeType {
+		if isNil {
+			return nil
+		}
+		tm, err := v.Date()
+		if err != nil {
+			return v.typeError("date")
+		}
+		dst.Set(reflect.ValueOf(tm))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Interface:
+		if isNil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		res, err := v.Export()
+		if err != nil {
+			return err
+		}
+		rv := reflect.ValueOf(res)
+		if !rv.Type().AssignableTo(dst.Type()) {
+			return fmt.Errorf("cannot assign %s to %s", rv.Type(), dst.Type())
+		}
+		dst.Set(rv)
+		return nil
+	case reflect.Ptr:
+		if isNil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return v.unmarshal(dst.Elem(), tags)
+	}
+
+	if isNil {
+		switch dst.Kind() {
+		case reflect.Map, reflect.Slice:
+			dst.Set(reflect.Zero(dst.Type()))
+		}
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Bool:
+		if !v.IsKind(KindBoolean) {
+			return v.typeError("boolean")
+		}
+		dst.SetBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !v.IsKind(KindNumber) {
+			return v.typeError("number")
+		}
+		f := v.Float64()
+		// The range is checked before converting, since converting a float
+		// that doesn't fit gives an arbitrary value. NaN isn't an integer.
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= -math.MinInt64 || dst.OverflowInt(int64(f)) {
+			return fmt.Errorf("number %v does not fit in %s", f, dst.Type())
+		}
+		dst.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !v.IsKind(KindNumber) {
+			return v.typeError("number")
+		}
+		f := v.Float64()
+		if f != math.Trunc(f) || f < 0 || f >= 1<<64 || dst.OverflowUint(uint64(f)) {
+			return fmt.Errorf("number %v does not fit in %s", f, dst.Type())
+		}
+		dst.SetUint(uint64(f))
+	case reflect.Float32, reflect.Float64:
+		if !v.IsKind(KindNumber) {
+			return v.typeError("number")
+		}
+		dst.SetFloat(v.Float64())
+	case reflect.String:
+		if !v.IsKind(KindString) {
+			return v.typeError("string")
+		}
+		dst.SetString(v.String())
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 && (v.IsKind(KindArrayBuffer) || v.IsKind(KindArrayBufferView)) {
+			data := v.Bytes()
+			if data == nil {
+				data = []byte{}
+			}
+			dst.SetBytes(data)
+			return nil
+		} else if hasTag(tags, "arraybuffer") {
+			return v.typeError("arraybuffer")
+		}
+		if !v.IsKind(KindArray) {
+			return v.typeError("array")
+		}
+		n, err := v.length()
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.MakeSlice(dst.Type(), n, n))
+		return v.unmarshalElems(dst, n)
+	case reflect.Array:
+		if !v.IsKind(KindArray) {
+			return v.typeError("array")
+		}
+		n, err := v.length()
+		if err != nil {
+			return err
+		}
+		if n > dst.Len() {
+			n = dst.Len()
+		}
+		dst.Set(reflect.Zero(dst.Type()))
+		return v.unmarshalElems(dst, n)
+	case reflect.Map:
+		if !v.IsKind(KindObject) {
+			return v.typeError("object")
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(dst.Type()))
+		}
+		if v.IsKind(KindMap) {
+			return v.unmarshalMapEntries(dst)
+		}
+		return v.unmarshalObjectEntries(dst)
+	case reflect.Struct:
+		if !v.IsKind(KindObject) {
+			return v.typeError("object")
+		}
+		return v.readStructFields(dst)
+	default:
+		return fmt.Errorf("%s not supported", dst.Type())
+	}
+	return nil
+}
+
+func (v *Value) unmarshalElems(dst reflect.Value, n int) error {
+	for i := 0; i < n; i++ {
+		elem, err := v.GetIndex(i)
+		if err != nil {
+			return fmt.Errorf("index %d: %v", i, err)
+		}
+		if err := elem.unmarshalAndRelease(dst.Index(i), nil); err != nil {
+			return fmt.Errorf("index %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (v *Value) unmarshalObjectEntries(dst reflect.Value) error {
+	keys, err := v.keys()
+	if err != nil {
+		return err
+	}
+	keyType, elemType := dst.Type().Key(), dst.Type().Elem()
+	for _, key := range keys {
+		k := reflect.New(keyType).Elem()
+		if err := setMapKey(k, key); err != nil {
+			return fmt.Errorf("map key %q: %v", key, err)
+		}
+		field, err := v.Get(key)
+		if err != nil {
+			return fmt.Errorf("map key %q: %v", key, err)
+		}
+		elem := reflect.New(elemType).Elem()
+		if err := field.unmarshalAndRelease(elem, nil); err != nil {
+			return fmt.Errorf("map key %q: %v", key, err)
+		}
+		dst.SetMapIndex(k, elem)
+	}
+	return nil
+}
+
+func (v *Value) unmarshalMapEntries(dst reflect.Value) error {
+	entries, err := v.asArray()
+	if err != nil {
+		return err
+	}
+	defer entries.release()
+	n, err := entries.length()
+	if err != nil {
+		return err
+	}
+	keyType, elemType := dst.Type().Key(), dst.Type().Elem()
+	for i := 0; i+1 < n; i += 2 {
+		key, err := entries.GetIndex(i)
+		if err != nil {
+			return fmt.Errorf("map key %d: %v", i/2, err)
+		}
+		k := reflect.New(keyType).Elem()
+		if err := key.unmarshalAndRelease(k, nil); err != nil {
+			return fmt.Errorf("map key %d: %v", i/2, err)
+		}
+		val, err := entries.GetIndex(i + 1)
+		if err != nil {
+			return fmt.Errorf("map key %v: %v", k, err)
+		}
+		elem := reflect.New(elemType).Elem()
+		if err := val.unmarshalAndRelease(elem, nil); err != nil {
+			return fmt.Errorf("map key %v: %v", k, err)
+		}
+		dst.SetMapIndex(k, elem)
+	}
+	return nil
+}
+
+func (v *Value) readStructFields(dst reflect.Value) error {
+	t := dst.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := getJsName(f.Name, f.Tag.Get("json"))
+		if name == "" {
+			continue // skip field with tag `json:"-"`
+		}
+
+		// Inline embedded fields.
+		if f.Anonymous {
+			sub := dst.Field(i)
+			for sub.Kind() == reflect.Ptr && sub.Type().Elem().Kind() == reflect.Struct {
+				if sub.IsNil() {
+					if !sub.CanSet() {
+						break // can't allocate unexported embedded pointers
+					}
+					sub.Set(reflect.New(sub.Type().Elem()))
+				}
+				sub = sub.Elem()
+			}
+
+			if sub.Kind() == reflect.Struct {
+				err := v.readStructFields(sub)
+				if err != nil {
+					return fmt.Errorf("Reading embedded field %q: %v", f.Name, err)
+				}
+				continue
+			}
+		}
+
+		if !unicode.IsUpper(rune(f.Name[0])) {
+			continue // skip unexported fields
+		}
+
+		field, err := v.Get(name)
+		if err != nil {
+			return fmt.Errorf("field %q: %v", f.Name, err)
+		} else if field.IsKind(KindUndefined) {
+			continue // leave missing fields as-is
+		}
+
+		v8Tags := strings.Split(f.Tag.Get("v8"), ",")
+		if err := field.unmarshalAndRelease(dst.Field(i), v8Tags); err != nil {
+			return fmt.Errorf("field %q: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// unmarshalAndRelease unmarshals the value into dst and then releases it unless
+// dst may be holding on to it.
+func (v *Value) unmarshalAndRelease(dst reflect.Value, tags []string) error {
+	err := v.unmarshal(dst, tags)
+	if !retainsValue(dst.Type()) {
+		v.release()
+	}
+	return err
+}
+
+// retainsValue returns whether a Go value of type t may directly hold the
+// *Value it was unmarshalled from.
+func retainsValue(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr && t != valuePtrType {
+		t = t.Elem()
+	}
+	return t == valuePtrType || t.Kind() == reflect.Interface
+}
+
+func (v *Value) length() (int, error) {
+	length, err := v.Get("length")
+	if err != nil {
+		return 0, err
+	}
+	defer length.release()
+	return int(length.Int64()), nil
+}
+
+func (v *Value) typeError(expected string) error {
+	got := "object"
+	for _, k := range []Kind{
+		KindUndefined, KindNull, KindBoolean, KindNumber, KindString, KindSymbol,
+		KindFunction, KindArray, KindDate, KindArrayBuffer, KindTypedArray,
+		KindMap, KindSet, KindPromise,
+	} {
+		if v.IsKind(k) {
+			got = strings.ToLower(k.String())
+			break
+		}
+	}
+	return fmt.Errorf("expected %s, got %s", expected, got)
+}
+
+func setMapKey(k reflect.Value, key string) error {
+	switch k.Kind() {
+	case reflect.String:
+		k.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, k.Type().Bits())
+		if err != nil {
+			return err
+		}
+		k.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(key, 10, k.Type().Bits())
+		if err != nil {
+			return err
+		}
+		k.SetUint(n)
+	default:
+		return fmt.Errorf("Map keys must be strings or integers, %s not allowed", k.Type())
+	}
+	return nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.TrimSpace(t) == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package v8
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalStruct(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	type Item struct {
+		Name  string
+		Count int `json:"count"`
+	}
+	type Embedded struct {
+		Inlined bool `json:"inlined"`
+	}
+	type Result struct {
+		*Embedded
+		Title    string            `json:"title,omitempty"`
+		Items    []Item            `json:"items"`
+		Tags     map[string]string `json:"tags"`
+		Ratio    float64
+		Optional *string
+		Data     []byte `v8:"arraybuffer"`
+		When     time.Time
+		Raw      *Value
+		Any      interface{}
+		Skipped  string `json:"-"`
+		Missing  string
+	}
+
+	val, err := ctx.Eval(`({
+		inlined: true,
+		title: "hello",
+		items: [{Name: "a", count: 1}, {Name: "b", count: 2}],
+		tags: {x: "y"},
+		Ratio: 0.5,
+		Optional: "here",
+		Data: new Uint8Array([1, 2, 3]).buffer,
+		When: new Date("2018-05-08T08:16:46.918Z"),
+		Raw: function() { return 3 },
+		Any: [1, "two"],
+		Skipped: "nope",
+	})`, "unmarshal.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := Result{Skipped: "keep", Missing: "keep"}
+	if err := val.Unmarshal(&res); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Embedded == nil || !res.Inlined {
+		t.Errorf("Expected embedded struct to be filled in, got %#v", res.Embedded)
+	}
+	if res.Title != "hello" {
+		t.Errorf("Wrong title: %q", res.Title)
+	}
+	if exp := []Item{{"a", 1}, {"b", 2}}; !reflect.DeepEqual(res.Items, exp) {
+		t.Errorf("Wrong items:\nExp: %#v\nGot: %#v", exp, res.Items)
+	}
+	if exp := map[string]string{"x": "y"}; !reflect.DeepEqual(res.Tags, exp) {
+		t.Errorf("Wrong tags:\nExp: %#v\nGot: %#v", exp, res.Tags)
+	}
+	if res.Ratio != 0.5 {
+		t.Errorf("Wrong ratio: %v", res.Ratio)
+	}
+	if res.Optional == nil || *res.Optional != "here" {
+		t.Errorf("Wrong optional: %v", res.Optional)
+	}
+	if !reflect.DeepEqual(res.Data, []byte{1, 2, 3}) {
+		t.Errorf("Wrong data: %v", res.Data)
+	}
+	if res.When.UnixNano() != 1525767406918*1e6 {
+		t.Errorf("Wrong date: %v", res.When)
+	}
+	if res.Raw == nil || !res.Raw.IsKind(KindFunction) {
+		t.Errorf("Expected raw function value, got %v", res.Raw)
+	}
+	if exp := []interface{}{1.0, "two"}; !reflect.DeepEqual(res.Any, exp) {
+		t.Errorf("Wrong any:\nExp: %#v\nGot: %#v", exp, res.Any)
+	}
+	if res.Skipped != "keep" || res.Missing != "keep" {
+		t.Errorf("Expected skipped and missing fields to be untouched: %q %q", res.Skipped, res.Missing)
+	}
+}
+
+func TestUnmarshalCreateRoundtrip(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	type Sub struct{ Val string }
+	type S struct {
+		Num   int
+		Names []string
+		Sub   *Sub
+		Buf   []byte `v8:"arraybuffer"`
+		Table map[string]int
+	}
+	orig := S{7, []string{"a", "b"}, &Sub{"x"}, []byte{9, 8}, map[string]int{"one": 1}}
+
+	val, err := ctx.Create(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res S
+	if err := val.Unmarshal(&res); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res, orig) {
+		t.Errorf("Roundtrip failed:\nExp: %#v\nGot: %#v", orig, res)
+	}
+}
+
+func TestUnmarshalMap(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	val, err := ctx.Eval(`new Map([[1, "one"], [2, "two"]])`, "map.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res map[int]string
+	if err := val.Unmarshal(&res); err != nil {
+		t.Fatal(err)
+	} else if exp := map[int]string{1: "one", 2: "two"}; !reflect.DeepEqual(res, exp) {
+		t.Errorf("Wrong map:\nExp: %#v\nGot: %#v", exp, res)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	t.Parallel()
+	ctx := NewIsolate().NewContext()
+
+	type S struct {
+		Items []int
+		Buf   []byte `v8:"arraybuffer"`
+		Small int8
+		Big   int64
+		Size  uint64
+	}
+
+	var testcases = []struct {
+		js  string
+		err string
+	}{
+		{`({Items: [1, 2, 3, "x"]})`, `field "Items": index 3: expected number, got string`},
+		{`({Items: 3})`, `field "Items": expected array, got number`},
+		{`({Buf: [1, 2]})`, `field "Buf": expected arraybuffer, got array`},
+		{`({Small: 1000})`, `field "Small": number 1000 does not fit in int8`},
+		{`({Small: 1.5})`, `field "Small": number 1.5 does not fit in int8`},
+		{`({Big: 1e20})`, `field "Big": number 1e+20 does not fit in int64`},
+		{`({Big: -Infinity})`, `field "Big": number -Inf does not fit in int64`},
+		{`({Big: NaN})`, `field "Big": number NaN does not fit in int64`},
+		{`({Size: 1e20})`, `field "Size": number 1e+20 does not fit in uint64`},
+		{`({Size: Infinity})`, `field "Size": number +Inf does not fit in uint64`},
+		{`({Size: -1})`, `field "Size": number -1 does not fit in uint64`},
+		{`"str"`, `expected object, got string`},
+	}
+
+	for i, test := range testcases {
+		val, err := ctx.Eval(test.js, "errors.js")
+		if err != nil {
+			t.Errorf("%d %#q: Failed to run js: %v", i, test.js, err)
+			continue
+		}
+		var s S
+		err = val.Unmarshal(&s)
+		if err == nil {
+			t.Errorf("%d %#q: Expected error, got %#v", i, test.js, s)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%d %#q: Wrong error:\nExp: %s\nGot: %v", i, test.js, test.err, err)
+		}
+	}
+
+	val, _ := ctx.Create(3)
+	var s S
+	if err := val.Unmarshal(s); err == nil {
+		t.Errorf("Expected error unmarshalling into a non-pointer")
+	}
+}
@@ -33,7 +33,8 @@ const jsConsoleStub = `console = (function() {
 // console stub object that will record all console logs.  This is necessary
 // when creating a snapshot for code that expects console.log to exist.  It also
 // surrounds the jsCode with a try/catch that logs the error, since otherwise
-// the snapshot will quietly fail.
+// the snapshot will quietly fail. Use v8.CreateSnapshotE to get the error
+// instead.
 func WrapForSnapshot(jsCode string) string {
 	return fmt.Sprintf(`
         // Prefix with the console stub:
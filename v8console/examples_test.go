@@ -3,17 +3,16 @@ package v8console_test
 import (
 	"fmt"
 	"os"
+	"testing/fstest"
 
 	"github.com/augustoroman/v8"
 	"github.com/augustoroman/v8/v8console"
+	"github.com/augustoroman/v8/v8require"
 )
 
 func ExampleFlushSnapshotAndInject() {
 	const myJsCode = `
         // Typically this will be an auto-generated js bundle file.
-        function require() {} // fake stub
-        var when = require('when');
-        var _ = require('lodash');
         function renderPage(name) { return "<html><body>Hi " + name + "!"; }
         console.warn('snapshot initialization');
     `
@@ -23,14 +22,18 @@ func ExampleFlushSnapshotAndInject() {
 	if exception := v8console.FlushSnapshotAndInject(ctx, console); exception != nil {
 		panic(fmt.Errorf("Panic during snapshot creation: %v", exception.String()))
 	}
-	_, err := ctx.Eval(`console.warn('after snapshot');`, `somefile.js`)
+	// Modules that are not part of the bundle can be loaded with v8require.
+	v8require.New(ctx, fstest.MapFS{
+		"node_modules/greeting/index.js": {Data: []byte(`module.exports = 'hi';`)},
+	})
+	_, err := ctx.Eval(`console.warn('after snapshot:', require('greeting'));`, `somefile.js`)
 	if err != nil {
 		panic(err)
 	}
 
 	// Output:
-	// console> [<embedded>:8] snapshot initialization
-	// console> [somefile.js:1] after snapshot
+	// console> [<embedded>:5] snapshot initialization
+	// console> [somefile.js:1] after snapshot: hi
 }
 
 func ExampleConfig() {
@@ -0,0 +1,84 @@
+package v8require_test
+
+import (
+	"fmt"
+	"os"
+	"testing/fstest"
+
+	"github.com/augustoroman/v8"
+	"github.com/augustoroman/v8/v8console"
+	"github.com/augustoroman/v8/v8require"
+)
+
+func Example() {
+	files := fstest.MapFS{
+		"app/main.js": {Data: []byte(`
+            const greet = require('./greet');
+            const pad = require('left-pad');
+            const config = require('../config.json');
+            module.exports = pad(greet(config.name), 12);
+        `)},
+		"app/greet.js": {Data: []byte(`
+            exports = module.exports = name => 'Hi ' + name;
+        `)},
+		"config.json":                        {Data: []byte(`{"name": "Bob"}`)},
+		"node_modules/left-pad/package.json": {Data: []byte(`{"main": "lib/pad"}`)},
+		"node_modules/left-pad/lib/pad.js": {Data: []byte(`
+            module.exports = (str, n) => ' '.repeat(Math.max(0, n - str.length)) + str;
+        `)},
+	}
+
+	ctx := v8.NewIsolate().NewContext()
+	loader := v8require.New(ctx, files)
+
+	res, err := loader.Require("./app/main")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%q\n", res)
+
+	// The same modules are available from javascript.
+	res, err = ctx.Eval(`require('./app/main') === require('/app/main.js')`, "cache.js")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(res)
+
+	// Output:
+	// "      Hi Bob"
+	// true
+}
+
+func ExampleLoader_circular() {
+	files := fstest.MapFS{
+		"a.js": {Data: []byte(`
+            exports.done = false;
+            const b = require('./b');
+            console.log('in a, b.done =', b.done);
+            exports.done = true;
+        `)},
+		"b.js": {Data: []byte(`
+            exports.done = false;
+            const a = require('./a');
+            console.log('in b, a.done =', a.done);
+            exports.done = true;
+        `)},
+	}
+
+	ctx := v8.NewIsolate().NewContext()
+	v8console.Config{Stdout: os.Stdout, Stderr: os.Stdout}.Inject(ctx)
+	v8require.New(ctx, files)
+
+	ctx.Eval(`
+        const a = require('./a'), b = require('./b');
+        console.log('in main, a.done =', a.done, 'b.done =', b.done);
+    `, "main.js")
+	_, err := ctx.Eval(`require('missing')`, "missing.js")
+	fmt.Println(err != nil)
+
+	// Output:
+	// in b, a.done = false
+	// in a, b.done = true
+	// in main, a.done = true b.done = true
+	// true
+}
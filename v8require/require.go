@@ -0,0 +1,203 @@
+// Package v8require provides a CommonJS require() implementation that loads
+// modules from a Go fs.FS.
+//
+// It supports relative and absolute paths, node_modules lookups, directories
+// with a package.json "main" field or an index file, and JSON modules.  Like
+// node, each module is evaluated only once per Context and require() returns
+// the cached module.exports after that, including for circular requires that
+// have not finished loading yet.
+//
+// All paths are slash-separated and relative to the root of the fs.FS, which
+// is also the directory that the global require function resolves relative
+// paths against.
+package v8require
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/augustoroman/v8"
+)
+
+// Loader loads and caches the modules of a single Context.
+type Loader struct {
+	ctx   *v8.Context
+	fsys  fs.FS
+	cache map[string]*v8.Value // module objects by filename
+}
+
+// New creates a Loader for modules in fsys and sets the global require function
+// of the specified Context.
+func New(ctx *v8.Context, fsys fs.FS) *Loader {
+	l := &Loader{ctx, fsys, map[string]*v8.Value{}}
+	if err := ctx.Global().Set("require", l.requireFrom(".")); err != nil {
+		// This should never happen: Global() is always an object.
+		panic(fmt.Errorf("cannot set require into global: %v", err))
+	}
+	return l
+}
+
+// Require loads the module id, resolved relative to the root of the fs.FS, and
+// returns its exports just like calling require(id) in javascript.
+func (l *Loader) Require(id string) (*v8.Value, error) {
+	return l.require(id, ".")
+}
+
+func (l *Loader) requireFrom(dir string) *v8.Value {
+	return l.ctx.Bind("require", func(in v8.CallbackArgs) (*v8.Value, error) {
+		id := in.Arg(0)
+		if !id.IsKind(v8.KindString) {
+			return nil, errors.New("module id must be a string")
+		}
+		return l.require(id.String(), dir)
+	})
+}
+
+func (l *Loader) require(id, dir string) (*v8.Value, error) {
+	filename, err := l.resolve(id, dir)
+	if err != nil {
+		return nil, err
+	}
+	if module, cached := l.cache[filename]; cached {
+		return module.Get("exports")
+	}
+
+	module, err := l.ctx.Create(map[string]interface{}{
+		"id":       filename,
+		"filename": filename,
+		"exports":  map[string]interface{}{},
+		"loaded":   false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Cache the module before loading it so that circular requires receive the
+	// exports as they are so far.
+	l.cache[filename] = module
+	if err := l.load(module, filename); err != nil {
+		delete(l.cache, filename)
+		return nil, err
+	}
+	if loaded, err := l.ctx.Create(true); err != nil {
+		return nil, err
+	} else if err := module.Set("loaded", loaded); err != nil {
+		return nil, err
+	}
+	return module.Get("exports")
+}
+
+func (l *Loader) load(module *v8.Value, filename string) error {
+	src, err := fs.ReadFile(l.fsys, filename)
+	if err != nil {
+		return err
+	}
+
+	if path.Ext(filename) == ".json" {
+		exports, err := l.ctx.ParseJson(string(src))
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		return module.Set("exports", exports)
+	}
+
+	// Wrap the code in a function just like node does so that the module has
+	// its own scope.
+	wrapper, err := l.ctx.Eval(
+		"(function (exports, require, module, __filename, __dirname) {"+
+			string(src)+"\n})", filename)
+	if err != nil {
+		return err
+	}
+	exports, err := module.Get("exports")
+	if err != nil {
+		return err
+	}
+	fname, err := l.ctx.Create(filename)
+	if err != nil {
+		return err
+	}
+	dname, err := l.ctx.Create(path.Dir(filename))
+	if err != nil {
+		return err
+	}
+	_, err = wrapper.Call(exports, exports, l.requireFrom(path.Dir(filename)), module, fname, dname)
+	return err
+}
+
+// resolve returns the filename of the module id required from dir.
+func (l *Loader) resolve(id, dir string) (string, error) {
+	if id == "" {
+		return "", errors.New("module id must not be empty")
+	}
+
+	isRelative := id == "." || id == ".." ||
+		strings.HasPrefix(id, "./") || strings.HasPrefix(id, "../")
+	switch {
+	case strings.HasPrefix(id, "/"):
+		if filename, ok := l.loadPath(path.Clean(id[1:])); ok {
+			return filename, nil
+		}
+	case isRelative:
+		if filename, ok := l.loadPath(path.Join(dir, id)); ok {
+			return filename, nil
+		}
+	default:
+		// Look in the node_modules directories of dir and all of its parents.
+		for d := dir; ; d = path.Dir(d) {
+			if path.Base(d) != "node_modules" {
+				if filename, ok := l.loadPath(path.Join(d, "node_modules", id)); ok {
+					return filename, nil
+				}
+			}
+			if d == "." {
+				break
+			}
+		}
+	}
+	return "", fmt.Errorf("Cannot find module '%s' from '%s'", id, dir)
+}
+
+// loadPath finds the file for the module at p, which may be a file with or
+// without extension or a directory.
+func (l *Loader) loadPath(p string) (string, bool) {
+	if strings.HasPrefix(p, "../") || p == ".." {
+		return "", false // outside of the fs
+	}
+	for _, filename := range []string{p, p + ".js", p + ".json"} {
+		if l.isFile(filename) {
+			return filename, true
+		}
+	}
+
+	if data, err := fs.ReadFile(l.fsys, path.Join(p, "package.json")); err == nil {
+		var pkg struct {
+			Main string `json:"main"`
+		}
+		if json.Unmarshal(data, &pkg) == nil && pkg.Main != "" {
+			main := path.Join(p, pkg.Main)
+			for _, filename := range []string{main, main + ".js", main + ".json",
+				path.Join(main, "index.js"), path.Join(main, "index.json")} {
+				if l.isFile(filename) {
+					return filename, true
+				}
+			}
+		}
+	}
+
+	for _, filename := range []string{path.Join(p, "index.js"), path.Join(p, "index.json")} {
+		if l.isFile(filename) {
+			return filename, true
+		}
+	}
+	return "", false
+}
+
+func (l *Loader) isFile(name string) bool {
+	info, err := fs.Stat(l.fsys, name)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,104 @@
+package v8require_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/augustoroman/v8"
+	"github.com/augustoroman/v8/v8require"
+)
+
+func TestMissingModule(t *testing.T) {
+	t.Parallel()
+	files := fstest.MapFS{
+		"app/main.js":   {Data: []byte(`require('./missing');`)},
+		"app/broken.js": {Data: []byte(`exports.x = ;`)},
+		"app/escape.js": {Data: []byte(`require('../../outside');`)},
+		"outside.js":    {Data: []byte(`module.exports = 1;`)},
+	}
+	ctx := v8.NewIsolate().NewContext()
+	loader := v8require.New(ctx, files)
+
+	testcases := []struct {
+		id, err string
+	}{
+		{"missing", "Cannot find module 'missing' from '.'"},
+		{"./app/main", "Cannot find module './missing' from 'app'"},
+		{"./app/escape", "Cannot find module '../../outside' from 'app'"},
+		{"./app/broken", "app/broken.js"},
+		{"", "module id must not be empty"},
+	}
+	for _, test := range testcases {
+		if _, err := loader.Require(test.id); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: Expected an error with %q, got %v", test.id, test.err, err)
+		}
+	}
+
+	// Modules that failed to load are not cached, so they're loaded again.
+	if _, err := ctx.Eval(`require('./app/broken')`, "main.js"); err == nil {
+		t.Errorf("Expected the syntax error again")
+	}
+}
+
+func TestCyclicRequire(t *testing.T) {
+	t.Parallel()
+	files := fstest.MapFS{
+		"a.js": {Data: []byte(`
+			exports.name = 'a';
+			const b = require('./b');
+			exports.b = b;
+			exports.loaded = module.loaded;
+		`)},
+		"b.js": {Data: []byte(`
+			const a = require('./a');
+			// a isn't done loading yet, so it only has the exports so far.
+			module.exports = {aName: a.name, aB: a.b, a: a};
+		`)},
+	}
+	ctx := v8.NewIsolate().NewContext()
+	v8require.New(ctx, files)
+
+	res, err := ctx.Eval(`
+		const a = require('./a'), b = require('./b');
+		[b.aName, String(b.aB), a.b === b, b.a === a, a.loaded].join(',')
+	`, "main.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := res.String(), "a,undefined,true,true,false"; got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestNodeModules(t *testing.T) {
+	t.Parallel()
+	files := fstest.MapFS{
+		"app/lib/deep/main.js": {Data: []byte(`
+			module.exports = [require('near'), require('far'), require('dir'), require('far/other')];
+		`)},
+		"app/node_modules/near.js":            {Data: []byte(`module.exports = 'app/near';`)},
+		"node_modules/near.js":                {Data: []byte(`module.exports = 'root/near';`)},
+		"node_modules/far/package.json":       {Data: []byte(`{"main": "./lib"}`)},
+		"node_modules/far/lib/index.js":       {Data: []byte(`module.exports = require('near') + ' via far';`)},
+		"node_modules/far/other.json":         {Data: []byte(`"far/other"`)},
+		"app/lib/node_modules/dir/index.json": {Data: []byte(`"app/lib/dir"`)},
+	}
+	ctx := v8.NewIsolate().NewContext()
+	loader := v8require.New(ctx, files)
+
+	res, err := loader.Require("./app/lib/deep/main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if err := res.Unmarshal(&got); err != nil {
+		t.Fatal(err)
+	}
+	// The nearest node_modules directory wins, and the modules in
+	// node_modules/far find their dependencies in the root node_modules.
+	expected := []string{"app/near", "root/near via far", "app/lib/dir", "far/other"}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}